@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"linuxService/pkg/interceptor"
@@ -37,6 +42,20 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "加密凭据库",
+}
+
+var vaultShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "解密并显示凭据库中的SOCKS5凭据（需要凭据库密钥）",
+	Args:  cobra.NoArgs,
+	RunE:  runVaultShow,
+	// 密钥错误等不是用法问题，不输出帮助
+	SilenceUsage: true,
+}
+
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "详细日志输出")
 	rootCmd.PersistentFlags().StringVar(&cleanupInterval, "cleanup-interval", "1h", "日志清理间隔时间 (例如: 30m, 1h, 2h)")
@@ -44,7 +63,31 @@ func init() {
 
 	// 容器内eBPF监控模式命令参数
 	rootCmd.Flags().String("program", "./socks5_monitor_container.o", "eBPF程序文件路径")
+	rootCmd.Flags().String("interface", "", "挂载eBPF的网络接口，逗号分隔多个 (留空自动选择默认路由接口)")
+	rootCmd.Flags().String("attach-mode", string(interceptor.AttachModeTC), "挂载方式: tc (网络接口TC分类器) 或 cgroup (linuxService所在cgroup v2)")
 	rootCmd.Flags().Duration("stats-interval", 30*time.Second, "统计报告间隔")
+	rootCmd.Flags().String("socks-ports", interceptor.DefaultSOCKSPorts, "监控的SOCKS5代理端口，逗号分隔")
+	rootCmd.Flags().String("socks-proxies", "", "额外监控的SOCKS5代理 IP:端口，逗号分隔 (例如: 10.0.0.1:1080,[2001:db8::1]:1080)")
+	rootCmd.Flags().String("socks-targets-file", "", "代理集合文件（端口或 IP:端口，每行或逗号分隔），设置后覆盖上面两项，收到SIGHUP时重新加载")
+	rootCmd.Flags().Bool("process-filter", true, "只上报linuxService及其子进程发起的连接")
+	rootCmd.Flags().Bool("reveal-passwords", false, "在日志和报告中输出明文SOCKS5密码（默认只输出带密钥的HMAC指纹）")
+	rootCmd.Flags().String("fingerprint-key-file", "", "密码指纹密钥文件，未设置时每次启动随机生成，指纹在重启后不可比较")
+	rootCmd.Flags().String("vault-file", "", "加密凭据库文件，设置后将提取到的SOCKS5凭据以AES-256-GCM加密保存 (需要配置凭据库密钥)")
+	rootCmd.Flags().String("vault-key-file", "", "凭据库密钥文件 (环境变量 VAULT_KEY 可直接提供密钥)")
+	rootCmd.Flags().String("event-sinks", "banner", "会话事件输出，逗号分隔多个: banner (认证报告)、logrus (结构化日志)、jsonl (JSON Lines)")
+	rootCmd.Flags().String("events-file", "", "jsonl 事件输出文件，留空输出到标准输出")
+	rootCmd.Flags().String("metrics-addr", "", "HTTP监控端点监听地址 (/metrics、/healthz、/readyz，例如 :9100)，留空不启动")
+	rootCmd.Flags().Bool("credentials-endpoint", false, "启动凭据历史端点 /credentials（只有指纹，没有认证，单独监听）")
+	rootCmd.Flags().String("credentials-addr", interceptor.DefaultCredentialsAddr, "凭据历史端点监听地址，默认只允许本机访问")
+	rootCmd.Flags().Duration("proxy-health-window", 5*time.Minute, "上游代理失败率统计窗口")
+	rootCmd.Flags().Float64("proxy-failure-threshold", 0.5, "窗口内上游代理握手失败率达到该值时告警 (0-1)")
+	rootCmd.Flags().Int("proxy-health-min-sessions", 5, "窗口内会话数达到该值才判定代理健康状态")
+
+	// 凭据库命令参数
+	vaultShowCmd.Flags().String("vault-file", "", "加密凭据库文件")
+	vaultShowCmd.Flags().String("vault-key-file", "", "凭据库密钥文件 (环境变量 VAULT_KEY 可直接提供密钥)")
+	vaultCmd.AddCommand(vaultShowCmd)
+	rootCmd.AddCommand(vaultCmd)
 }
 
 func setupLogger() {
@@ -73,13 +116,59 @@ func runContainerEbpfMonitor(cmd *cobra.Command, args []string) error {
 
 	// 获取配置（优先使用环境变量，其次命令行参数）
 	program := getEnvString("EBPF_PROGRAM", cmd, "program", "./socks5_monitor_container.o")
+	interfaceName := getEnvString("EBPF_INTERFACE", cmd, "interface", "")
+	attachMode, err := interceptor.ParseAttachMode(getEnvString("EBPF_ATTACH_MODE", cmd, "attach-mode", string(interceptor.AttachModeTC)))
+	if err != nil {
+		return err
+	}
 	containerMode := getEnvBool("CONTAINER_MODE", cmd, "container-mode", true)
 	statsInterval := getEnvDuration("STATS_INTERVAL", cmd, "stats-interval", 30*time.Second)
+	socksPorts := getEnvString("SOCKS_PORTS", cmd, "socks-ports", interceptor.DefaultSOCKSPorts)
+	socksProxies := getEnvString("SOCKS_PROXIES", cmd, "socks-proxies", "")
+	targetsFile := getEnvString("SOCKS_TARGETS_FILE", cmd, "socks-targets-file", "")
+	processFilter := getEnvBool("PROCESS_FILTER", cmd, "process-filter", true)
+	metricsAddr := getEnvString("METRICS_ADDR", cmd, "metrics-addr", "")
+	credentialsAddr := ""
+	if getEnvBool("CREDENTIALS_ENDPOINT", cmd, "credentials-endpoint", false) {
+		credentialsAddr = getEnvString("CREDENTIALS_ADDR", cmd, "credentials-addr", interceptor.DefaultCredentialsAddr)
+	}
+	revealPasswords := getEnvBool("REVEAL_PASSWORDS", cmd, "reveal-passwords", false)
+	fingerprintKey, err := loadKey("FINGERPRINT_KEY", getEnvString("FINGERPRINT_KEY_FILE", cmd, "fingerprint-key-file", ""))
+	if err != nil {
+		return fmt.Errorf("读取指纹密钥失败: %w", err)
+	}
+	redactor, err := interceptor.NewCredentialRedactor(fingerprintKey, revealPasswords)
+	if err != nil {
+		return err
+	}
+	vaultFile := getEnvString("VAULT_FILE", cmd, "vault-file", "")
+	eventSinks := getEnvString("EVENT_SINKS", cmd, "event-sinks", "banner")
+	eventsFile := getEnvString("EVENTS_FILE", cmd, "events-file", "")
+	healthConfig := interceptor.ProxyHealthConfig{
+		Window:           getEnvDuration("PROXY_HEALTH_WINDOW", cmd, "proxy-health-window", 5*time.Minute),
+		FailureThreshold: getEnvFloat("PROXY_FAILURE_THRESHOLD", cmd, "proxy-failure-threshold", 0.5),
+		MinSessions:      getEnvInt("PROXY_HEALTH_MIN_SESSIONS", cmd, "proxy-health-min-sessions", 5),
+	}
+
+	proxyTargets, err := loadProxyTargets(socksPorts, socksProxies, targetsFile)
+	if err != nil {
+		return fmt.Errorf("解析代理集合失败: %w", err)
+	}
 
 	logrus.WithFields(logrus.Fields{
-		"program":        program,
-		"container_mode": containerMode,
-		"stats_interval": statsInterval,
+		"program":          program,
+		"interface":        interfaceName,
+		"attach_mode":      attachMode,
+		"container_mode":   containerMode,
+		"stats_interval":   statsInterval,
+		"proxy_targets":    proxyTargets.String(),
+		"process_filter":   processFilter,
+		"metrics_addr":     metricsAddr,
+		"credentials_addr": credentialsAddr,
+		"reveal_password":  revealPasswords,
+		"vault_file":       vaultFile,
+		"event_sinks":      eventSinks,
+		"proxy_health":     fmt.Sprintf("window=%s threshold=%.2f min_sessions=%d", healthConfig.Window, healthConfig.FailureThreshold, healthConfig.MinSessions),
 	}).Info("📋 容器内eBPF监控器配置")
 
 	// 创建上下文
@@ -90,10 +179,48 @@ func runContainerEbpfMonitor(cmd *cobra.Command, args []string) error {
 	go startLogCleaner(ctx)
 
 	// 创建容器内eBPF监控器
-	ebpfMonitor, err := interceptor.NewEbpfMonitor(program, "")
+	ebpfMonitor, err := interceptor.NewEbpfMonitor(program, interfaceName)
 	if err != nil {
 		logrus.WithError(err).Fatal("❌ 创建容器内eBPF监控器失败")
 	}
+	if err := ebpfMonitor.SetProxyTargets(proxyTargets); err != nil {
+		return err
+	}
+	ebpfMonitor.SetAttachMode(attachMode)
+	ebpfMonitor.SetProcessFilter(processFilter)
+	if err := ebpfMonitor.SetProxyHealthConfig(healthConfig); err != nil {
+		return err
+	}
+	ebpfMonitor.SetMetricsAddr(metricsAddr)
+	ebpfMonitor.SetCredentialsAddr(credentialsAddr)
+	ebpfMonitor.SetCredentialRedactor(redactor)
+	if revealPasswords {
+		logrus.Warn("⚠️ 已启用明文密码输出，日志中将包含SOCKS5密码")
+	}
+	if redactor.Ephemeral() {
+		logrus.Info("🔑 未配置指纹密钥，使用随机密钥，密码指纹在重启后会变化")
+	}
+	if vaultFile != "" {
+		vault, err := openVault(cmd, vaultFile)
+		if err != nil {
+			return err
+		}
+		defer vault.Close()
+		ebpfMonitor.SetCredentialVault(vault)
+		logrus.WithField("vault_file", vaultFile).Info("🔐 已启用加密凭据库")
+	}
+
+	sinks, closeSinks, err := buildEventSinks(eventSinks, eventsFile)
+	if err != nil {
+		return err
+	}
+	defer closeSinks()
+	ebpfMonitor.SetEventSinks(sinks...)
+
+	// SIGHUP 重新加载代理集合文件
+	if targetsFile != "" {
+		go watchProxyTargetsReload(ctx, ebpfMonitor, targetsFile)
+	}
 
 	// 监听信号
 	sigChan := make(chan os.Signal, 1)
@@ -109,6 +236,144 @@ func runContainerEbpfMonitor(cmd *cobra.Command, args []string) error {
 	return ebpfMonitor.Start(ctx, statsInterval)
 }
 
+// loadProxyTargets 构建代理集合，设置了文件时以文件为准
+func loadProxyTargets(ports, proxies, file string) (*interceptor.ProxyTargets, error) {
+	if file == "" {
+		return interceptor.ParseProxyTargets(ports, proxies)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取代理集合文件失败: %w", err)
+	}
+	return interceptor.ParseProxyTargetList(string(content))
+}
+
+// buildEventSinks 按名称创建会话事件接收者，返回的函数关闭事件文件
+func buildEventSinks(names, file string) ([]interceptor.EventSink, func(), error) {
+	var sinks []interceptor.EventSink
+	var closers []io.Closer
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "banner":
+			sinks = append(sinks, interceptor.NewBannerEventSink(os.Stdout))
+		case "logrus":
+			sinks = append(sinks, interceptor.NewLogrusEventSink(logrus.WithField("component", "socks5-events")))
+		case "jsonl":
+			var w io.Writer = os.Stdout
+			if file != "" {
+				// 事件中包含用户名和密码指纹（或明文），只允许属主读写
+				f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+				if err != nil {
+					closeAll()
+					return nil, nil, fmt.Errorf("打开事件文件失败: %w", err)
+				}
+				closers = append(closers, f)
+				w = f
+			}
+			sinks = append(sinks, interceptor.NewJSONLinesEventSink(w))
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("未知的事件输出: %s (可选 banner、logrus、jsonl)", name)
+		}
+	}
+	return sinks, closeAll, nil
+}
+
+// loadKey 读取密钥：环境变量 envKey 优先，其次为密钥文件，都未设置时返回 nil
+func loadKey(envKey, file string) ([]byte, error) {
+	if key := os.Getenv(envKey); key != "" {
+		return []byte(key), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(content), nil
+}
+
+// loadVaultKey 读取凭据库密钥，未配置时报错
+func loadVaultKey(cmd *cobra.Command) ([]byte, error) {
+	key, err := loadKey("VAULT_KEY", getEnvString("VAULT_KEY_FILE", cmd, "vault-key-file", ""))
+	if err != nil {
+		return nil, fmt.Errorf("读取凭据库密钥失败: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("未配置凭据库密钥 (--vault-key-file 或环境变量 VAULT_KEY/VAULT_KEY_FILE)")
+	}
+	return key, nil
+}
+
+// openVault 打开或创建加密凭据库
+func openVault(cmd *cobra.Command, file string) (*interceptor.CredentialVault, error) {
+	key, err := loadVaultKey(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return interceptor.OpenCredentialVault(file, key)
+}
+
+// runVaultShow 解密并输出凭据库内容
+func runVaultShow(cmd *cobra.Command, args []string) error {
+	file := getEnvString("VAULT_FILE", cmd, "vault-file", "")
+	if file == "" {
+		return fmt.Errorf("未指定凭据库文件 (--vault-file 或环境变量 VAULT_FILE)")
+	}
+	key, err := loadVaultKey(cmd)
+	if err != nil {
+		return err
+	}
+
+	// 中途损坏的记录之前的内容仍然输出
+	entries, err := interceptor.ReadCredentialVault(file, key)
+	if err != nil && len(entries) == 0 {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CAPTURED_AT\tSESSION\tPROXY\tCLIENT\tUSERNAME\tPASSWORD\tFINGERPRINT")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.CapturedAt.Local().Format(time.RFC3339), entry.SessionID, entry.Proxy, entry.Client,
+			entry.Username, entry.Password, entry.Fingerprint)
+	}
+	w.Flush()
+	return err
+}
+
+// watchProxyTargetsReload 收到SIGHUP时重新加载代理集合文件并同步到内核
+func watchProxyTargetsReload(ctx context.Context, monitor *interceptor.ContainerMonitor, file string) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupChan:
+			targets, err := loadProxyTargets("", "", file)
+			if err != nil {
+				logrus.WithError(err).WithField("file", file).Error("❌ 重新加载代理集合失败，保留原配置")
+				continue
+			}
+			if err := monitor.SetProxyTargets(targets); err != nil {
+				logrus.WithError(err).Error("❌ 同步代理集合到内核失败")
+			}
+		}
+	}
+}
+
 // startLogCleaner 启动日志清理器
 func startLogCleaner(ctx context.Context) {
 	logrus.Info("🧹 启动日志清理器 - 每5分钟清理一次logs/*")
@@ -239,3 +504,22 @@ func getEnvInt(envKey string, cmd *cobra.Command, flagName string, defaultValue
 
 	return defaultValue
 }
+
+// getEnvFloat 从环境变量获取浮点数配置
+func getEnvFloat(envKey string, cmd *cobra.Command, flagName string, defaultValue float64) float64 {
+	if envValue := os.Getenv(envKey); envValue != "" {
+		value, err := strconv.ParseFloat(envValue, 64)
+		if err == nil {
+			return value
+		}
+		logrus.WithError(err).WithField("env_key", envKey).WithField("value", envValue).Warn("解析环境变量失败，使用默认值")
+	}
+
+	if cmd.Flags().Changed(flagName) {
+		if value, err := cmd.Flags().GetFloat64(flagName); err == nil {
+			return value
+		}
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,90 @@
+package interceptor
+
+import (
+	"fmt"
+	"time"
+)
+
+// authReportWindow 同一会话内容相同的认证报告在该时间内只输出一次
+const authReportWindow = time.Minute
+
+// authReportKey 按会话、代理和用户名区分报告，会话ID被新连接复用时凭据不同也不会被合并
+type authReportKey struct {
+	session  string
+	proxy    string
+	username string
+}
+
+// authReportState 会话最近一次输出的报告
+type authReportState struct {
+	signature  string
+	reportedAt time.Time
+	suppressed uint64 // 上次输出后被合并的重复报告数
+}
+
+// ReportSuppression 随事件输出的重复计数
+type ReportSuppression struct {
+	Session    uint64 // 本会话上次报告后被合并的次数
+	Credential uint64 // 同一 代理+用户名 上次报告后被合并的次数（含其他会话）
+}
+
+// authReportSignature 报告内容摘要，内容变化（认证结果、目标、应答）时重新输出
+func authReportSignature(session *SOCKS5Session) string {
+	reply := ""
+	if session.Reply != nil {
+		reply = session.Reply.Code.String()
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%s", session.PasswordFingerprint, session.AuthResult, session.Status,
+		joinHostPort(session.TargetHost, session.TargetPort), reply)
+}
+
+// shouldReportAuth 判断是否输出认证、请求事件，重复的事件计入会话和 代理+用户名 的合并计数
+// 返回 true 时附带上次报告以来的合并计数并清零
+func (m *EnhancedSOCKS5Monitor) shouldReportAuth(session *SOCKS5Session, now time.Time) (ReportSuppression, bool) {
+	proxy := joinHostPort(session.ProxyIP, session.ProxyPort)
+	key := authReportKey{session: session.SessionID, proxy: proxy, username: session.Username}
+	credential := credentialKey{proxy: proxy, username: session.Username}
+	signature := authReportSignature(session)
+
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+	if m.authReports == nil {
+		m.authReports = make(map[authReportKey]*authReportState)
+		m.reportSuppressed = make(map[credentialKey]uint64)
+	}
+
+	state, ok := m.authReports[key]
+	if ok && state.signature == signature && now.Sub(state.reportedAt) < authReportWindow {
+		state.suppressed++
+		m.reportSuppressed[credential]++
+		m.suppressedReports.Add(1)
+		return ReportSuppression{}, false
+	}
+	if !ok {
+		state = &authReportState{}
+		m.authReports[key] = state
+	}
+
+	suppression := ReportSuppression{Session: state.suppressed, Credential: m.reportSuppressed[credential]}
+	state.signature = signature
+	state.reportedAt = now
+	state.suppressed = 0
+	delete(m.reportSuppressed, credential)
+	return suppression, true
+}
+
+// pruneAuthReports 清理超出去重窗口的会话报告记录
+func (m *EnhancedSOCKS5Monitor) pruneAuthReports(now time.Time) {
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+	for key, state := range m.authReports {
+		if now.Sub(state.reportedAt) >= authReportWindow {
+			delete(m.authReports, key)
+		}
+	}
+}
+
+// SuppressedReports 累计被合并的重复认证报告数
+func (m *EnhancedSOCKS5Monitor) SuppressedReports() uint64 {
+	return m.suppressedReports.Load()
+}
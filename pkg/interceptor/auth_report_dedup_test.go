@@ -0,0 +1,132 @@
+package interceptor
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// authAttempt 客户端从 port 新建连接并发送用户名密码认证，代理没有应答（连接随后在同一端口被复用）
+type authAttempt struct {
+	port     uint16
+	password string
+	age      time.Duration // 发送前把已有的报告记录提前这么久，模拟时间流逝
+	cleanup  bool          // 发送前运行一次 CleanupSessions，清理超出窗口的报告记录
+	reported bool
+	want     ReportSuppression // 输出的报告携带的合并计数
+}
+
+func TestAuthReportDedup(t *testing.T) {
+	cases := []struct {
+		name       string
+		attempts   []authAttempt
+		suppressed uint64
+	}{
+		{
+			name: "duplicates within window",
+			attempts: []authAttempt{
+				{port: 40001, password: "secret", reported: true},
+				{port: 40001, password: "secret"},
+				{port: 40001, password: "secret", age: authReportWindow / 2},
+			},
+			suppressed: 2,
+		},
+		{
+			name: "changed credentials reported with suppressed count",
+			attempts: []authAttempt{
+				{port: 40001, password: "secret", reported: true},
+				{port: 40001, password: "secret"},
+				{port: 40001, password: "secret"},
+				{port: 40001, password: "rotated", reported: true, want: ReportSuppression{Session: 2, Credential: 2}},
+				{port: 40001, password: "rotated"},
+			},
+			suppressed: 3,
+		},
+		{
+			name: "reported again after window",
+			attempts: []authAttempt{
+				{port: 40001, password: "secret", reported: true},
+				{port: 40001, password: "secret"},
+				{port: 40001, password: "secret", age: authReportWindow, reported: true, want: ReportSuppression{Session: 1, Credential: 1}},
+				{port: 40001, password: "secret"},
+			},
+			suppressed: 2,
+		},
+		{
+			name: "sessions deduplicated independently",
+			attempts: []authAttempt{
+				{port: 40001, password: "secret", reported: true},
+				{port: 40002, password: "secret", reported: true},
+				{port: 40001, password: "secret"},
+				{port: 40002, password: "secret"},
+				// 同一 代理+用户名 的计数包含其他会话被合并的报告
+				{port: 40003, password: "secret", reported: true, want: ReportSuppression{Credential: 2}},
+			},
+			suppressed: 2,
+		},
+		{
+			name: "pruned session keeps credential count",
+			attempts: []authAttempt{
+				{port: 40001, password: "secret", reported: true},
+				{port: 40001, password: "secret"},
+				{port: 40001, password: "secret", age: authReportWindow, cleanup: true, reported: true, want: ReportSuppression{Credential: 1}},
+			},
+			suppressed: 1,
+		},
+	}
+
+	client, proxy := net.ParseIP("10.0.1.1"), net.ParseIP("10.0.0.9")
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reports []SessionEvent
+			m := newTestMonitor()
+			m.SetEventSink(EventSinkFunc(func(event SessionEvent) {
+				if event.Type == EventAuthenticated {
+					reports = append(reports, event)
+				}
+			}))
+
+			for i, attempt := range tc.attempts {
+				if attempt.age > 0 {
+					ageAuthReports(m, attempt.age)
+				}
+				if attempt.cleanup {
+					m.CleanupSessions()
+				}
+
+				before := len(reports)
+				const isn = 1000
+				m.HandleAuthEvent(&SOCKS5AuthEvent{Type: SOCKS5EventFlow, Direction: DirectionClientToProxy, SrcIP: client, DstIP: proxy,
+					SrcPort: attempt.port, DstPort: 1080, Seq: isn, TCPFlags: tcpFlagSYN})
+				auth := &SOCKS5AuthEvent{Type: SOCKS5EventAuth, Direction: DirectionClientToProxy, SrcIP: client, DstIP: proxy,
+					SrcPort: attempt.port, DstPort: 1080, Seq: isn + 1, Username: "alice", Password: attempt.password,
+					UsernameLen: 5, PasswordLen: uint8(len(attempt.password))}
+				auth.SegLen = uint32(len(auth.AuthPayload()))
+				m.HandleAuthEvent(auth)
+
+				got := reports[before:]
+				if reported := len(got) > 0; reported != attempt.reported {
+					t.Fatalf("attempt %d (port %d, %s): reported = %v, want %v", i, attempt.port, attempt.password, reported, attempt.reported)
+				}
+				if len(got) > 1 {
+					t.Fatalf("attempt %d: %d reports, want 1", i, len(got))
+				}
+				if attempt.reported && got[0].Suppressed != attempt.want {
+					t.Errorf("attempt %d: Suppressed = %+v, want %+v", i, got[0].Suppressed, attempt.want)
+				}
+			}
+			if got := m.SuppressedReports(); got != tc.suppressed {
+				t.Errorf("SuppressedReports() = %d, want %d", got, tc.suppressed)
+			}
+		})
+	}
+}
+
+// ageAuthReports 把已有的报告记录提前 d
+func ageAuthReports(m *EnhancedSOCKS5Monitor, d time.Duration) {
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+	for _, state := range m.authReports {
+		state.reportedAt = state.reportedAt.Add(-d)
+	}
+}
@@ -0,0 +1,101 @@
+package interceptor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// AttachMode eBPF程序的挂载方式
+type AttachMode string
+
+const (
+	AttachModeTC     AttachMode = "tc"     // 网络接口上的TC egress/ingress分类器
+	AttachModeCgroup AttachMode = "cgroup" // linuxService 所在cgroup v2上的 cgroup_skb egress/ingress
+)
+
+// cgroup2Root cgroup v2 统一层级的挂载点
+const cgroup2Root = "/sys/fs/cgroup"
+
+// ParseAttachMode 解析挂载方式，空值为 tc
+func ParseAttachMode(value string) (AttachMode, error) {
+	switch AttachMode(strings.ToLower(strings.TrimSpace(value))) {
+	case "", AttachModeTC:
+		return AttachModeTC, nil
+	case AttachModeCgroup:
+		return AttachModeCgroup, nil
+	default:
+		return "", fmt.Errorf("无效的挂载方式: %q (可选: tc, cgroup)", value)
+	}
+}
+
+// cgroupAttachment 挂载在一个cgroup上的 cgroup_skb 程序
+type cgroupAttachment struct {
+	path  string
+	links []link.Link
+}
+
+// attachCgroup 将 egress/ingress 程序挂载到cgroup，与TC不同，cgroup_skb 只看到该cgroup内进程的流量
+func attachCgroup(path string, egress, ingress *ebpf.Program) (*cgroupAttachment, error) {
+	attachment := &cgroupAttachment{path: path}
+
+	for _, hook := range []struct {
+		attach ebpf.AttachType
+		prog   *ebpf.Program
+	}{
+		{ebpf.AttachCGroupInetEgress, egress},
+		{ebpf.AttachCGroupInetIngress, ingress},
+	} {
+		l, err := link.AttachCgroup(link.CgroupOptions{
+			Path:    path,
+			Attach:  hook.attach,
+			Program: hook.prog,
+		})
+		if err != nil {
+			attachment.Close()
+			return nil, fmt.Errorf("挂载 %s 失败: %w", hook.attach, err)
+		}
+		attachment.links = append(attachment.links, l)
+	}
+
+	return attachment, nil
+}
+
+// Close 从cgroup卸载程序
+func (a *cgroupAttachment) Close() error {
+	var errs []error
+	for i := len(a.links) - 1; i >= 0; i-- {
+		if err := a.links[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	a.links = nil
+	return errors.Join(errs...)
+}
+
+// cgroupPathForPID 读取 /proc/<pid>/cgroup 中的cgroup v2路径
+func cgroupPathForPID(pid int) (string, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", fmt.Errorf("读取进程cgroup失败: %w", err)
+	}
+	defer file.Close()
+
+	// cgroup v2 条目格式: 0::/path
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rel, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroup2Root, rel), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("读取进程cgroup失败: %w", err)
+	}
+	return "", fmt.Errorf("进程 %d 不在cgroup v2层级中", pid)
+}
@@ -6,6 +6,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,13 +18,41 @@ import (
 
 // ContainerMonitor 容器内linuxService监控器（专注、简化、高性能）
 type ContainerMonitor struct {
-	programPath     string // eBPF程序路径
+	programPath     string   // eBPF程序路径
+	interfaceNames  []string // 挂载TC分类器的网络接口，为空时自动探测默认路由接口
 	logger          *logrus.Entry
-	linuxServiceCmd *exec.Cmd // linuxService 进程命令
-	linuxServicePID int       // linuxService 进程 PID
+	objs            *ebpfObjects      // 已加载的eBPF程序和映射
+	attachMode      AttachMode        // 挂载方式：tc / cgroup
+	attachments     []*tcAttachment   // 已挂载的TC分类器，由 targetsMu 保护
+	cgroup          *cgroupAttachment // cgroup模式下已挂载的 cgroup_skb 程序，随 linuxService 的cgroup更新
+	cgroupErr       error             // cgroup模式下最近一次挂载失败的原因，由 targetsMu 保护
+	interfaceStatus []InterfaceStatus // 各接口挂载状态，由 targetsMu 保护
+	attributionMode string            // 进程归属方式：fentry / unavailable
+	processFilter   bool              // 是否只上报 linuxService 进程树发起的连接
+	filterMode      string            // 进程过滤状态：process_tree / disabled / unavailable
+	socks5Monitor   *EnhancedSOCKS5Monitor
+	proxyTargets    *ProxyTargets // 需要监控的代理集合
+	healthConfig    ProxyHealthConfig
+	redactor        *CredentialRedactor // 凭据脱敏策略，为空时使用默认策略
+	vault           *CredentialVault    // 加密凭据库，为空时不保存凭据
+	eventSink       EventSink           // 会话事件接收者，为空时输出默认的认证报告
+	metricsAddr     string              // HTTP监控端点监听地址，为空时不启动
+	credentialsAddr string              // 凭据历史端点监听地址，为空时不启动
+	startTime       time.Time           // Start 被调用的时间
+	targetsMu       sync.Mutex          // 保护 proxyTargets 与内核映射的同步，以及挂载状态
+	eventReader     *EventReader
+	linuxServiceCmd atomic.Pointer[exec.Cmd] // linuxService 进程命令，重启时由监控协程替换
+	linuxServicePID atomic.Int64             // linuxService 进程 PID，未运行时为0
+	serviceRestarts atomic.Uint64
+	serviceDownAt   atomic.Int64           // linuxService 最近一次退出的时间（UnixNano），运行中为0
+	serviceLastExit atomic.Pointer[string] // linuxService 最近一次退出的原因
 }
 
+// linuxServiceRestartDelay linuxService 异常退出后重启前的等待时间
+const linuxServiceRestartDelay = 5 * time.Second
+
 // NewEbpfMonitor 创建新的容器内监控器
+// interfaceName 支持逗号分隔的多个接口，留空时自动选择默认路由所在接口
 func NewEbpfMonitor(programPath, interfaceName string) (*ContainerMonitor, error) {
 	// 检查eBPF程序文件是否存在
 	if _, err := os.Stat(programPath); os.IsNotExist(err) {
@@ -28,7 +60,12 @@ func NewEbpfMonitor(programPath, interfaceName string) (*ContainerMonitor, error
 	}
 
 	return &ContainerMonitor{
-		programPath: programPath,
+		programPath:    programPath,
+		interfaceNames: parseInterfaceNames(interfaceName),
+		proxyTargets:   DefaultProxyTargets(),
+		attachMode:     AttachModeTC,
+		processFilter:  true,
+		healthConfig:   DefaultProxyHealthConfig(),
 		logger: logrus.WithFields(logrus.Fields{
 			"component": "container-monitor",
 			"program":   filepath.Base(programPath),
@@ -39,20 +76,70 @@ func NewEbpfMonitor(programPath, interfaceName string) (*ContainerMonitor, error
 // Start 启动容器内监控
 func (c *ContainerMonitor) Start(ctx context.Context, statsInterval time.Duration) error {
 	c.logger.Info("🚀 启动容器内linuxService监控器...")
+	c.startTime = time.Now()
 	c.logger.Info("🎯 专注功能：监控容器内linuxService进程的*.qq.com流量和SOCKS5认证")
 
+	// 加载并挂载eBPF程序
+	if err := c.loadAndAttachEbpf(); err != nil {
+		return err
+	}
+	defer c.detachEbpf()
+
 	// 启动 linuxService 并获取 PID
 	if err := c.startLinuxService(ctx); err != nil {
 		return fmt.Errorf("启动linuxService失败: %w", err)
 	}
 
+	// cgroup模式在 linuxService 启动后才能确定挂载位置
+	if c.attachMode == AttachModeCgroup {
+		if path, err := c.cgroupStatus(); path == "" {
+			c.stopLinuxService()
+			return &EbpfError{Stage: EbpfStageAttach, Program: c.programPath, Err: err}
+		}
+	}
+
+	// 创建增强SOCKS5监控器，专注于linuxService进程
+	c.targetsMu.Lock()
+	c.socks5Monitor = NewEnhancedSOCKS5Monitor(c.GetLinuxServicePID(), c.proxyTargets)
+	c.socks5Monitor.SetFlowStatsSource(c.flowCounters)
+	c.socks5Monitor.SetProxyHealthConfig(c.healthConfig)
+	c.socks5Monitor.SetProxyHealthAlertHandler(c.reportProxyHealth)
+	c.socks5Monitor.SetCredentialRedactor(c.redactor)
+	c.socks5Monitor.SetCredentialRotationHandler(c.reportCredentialRotation)
+	c.socks5Monitor.SetCredentialVault(c.vault)
+	c.socks5Monitor.SetEventSink(c.eventSink)
+	c.targetsMu.Unlock()
+
+	// 启动eBPF事件读取器
+	eventReader, err := NewEventReader(c.objs.Events, c.socks5Monitor)
+	if err != nil {
+		c.stopLinuxService()
+		return &EbpfError{Stage: EbpfStageMap, Program: c.programPath, Err: err}
+	}
+	c.eventReader = eventReader
+	go c.eventReader.Run(ctx)
+
 	// 启动增强SOCKS5监控（核心功能）
 	go c.startEnhancedSOCKS5Monitor(ctx, statsInterval)
 
 	// 启动状态报告器
 	go c.startStatusReporter(ctx, statsInterval)
 
-	c.logger.WithField("linux_service_pid", c.linuxServicePID).Info("✅ 容器内监控器启动完成")
+	// 启动HTTP监控端点（可选）
+	if c.metricsAddr != "" {
+		if err := c.startMetricsServer(ctx); err != nil {
+			c.stopLinuxService()
+			return err
+		}
+	}
+	if c.credentialsAddr != "" {
+		if err := c.startCredentialsServer(ctx); err != nil {
+			c.stopLinuxService()
+			return err
+		}
+	}
+
+	c.logger.WithField("linux_service_pid", c.GetLinuxServicePID()).Info("✅ 容器内监控器启动完成")
 
 	// 等待上下文取消
 	<-ctx.Done()
@@ -64,6 +151,336 @@ func (c *ContainerMonitor) Start(ctx context.Context, statsInterval time.Duratio
 	return nil
 }
 
+// loadAndAttachEbpf 加载eBPF对象；TC模式挂载到各接口，cgroup模式在 linuxService 启动后挂载
+func (c *ContainerMonitor) loadAndAttachEbpf() error {
+	c.logger.WithField("attach_mode", c.attachMode).Info("📦 加载eBPF程序...")
+
+	objs, err := loadEbpfObjects(c.programPath)
+	if err != nil {
+		return err
+	}
+	c.objs = objs
+
+	// 写入代理集合，内核与用户空间使用同一份配置
+	c.targetsMu.Lock()
+	err = objs.syncProxyTargets(c.proxyTargets)
+	c.targetsMu.Unlock()
+	if err != nil {
+		c.detachEbpf()
+		return &EbpfError{Stage: EbpfStageMap, Program: c.programPath, Err: err}
+	}
+
+	// 挂载进程归属程序，失败时事件中的PID为0
+	if err := objs.attribution.Attach(); err != nil {
+		c.logger.WithError(err).Warn("⚠️ 进程归属不可用，无法确定SOCKS5连接的发起进程")
+	} else {
+		c.logger.Info("✅ 进程归属程序已挂载 (fentry: tcp_connect, tcp_sendmsg)")
+	}
+	c.attributionMode = objs.attribution.Mode()
+
+	// 挂载进程树跟踪点，过滤依赖进程归属，两者缺一不可
+	switch {
+	case !c.processFilter:
+		c.filterMode = "disabled"
+	case c.attributionMode != "fentry":
+		c.filterMode = "unavailable"
+		c.logger.Warn("⚠️ 进程归属不可用，无法按linuxService进程树过滤流量")
+	default:
+		if err := objs.processTree.Attach(); err != nil {
+			c.filterMode = "unavailable"
+			c.logger.WithError(err).Warn("⚠️ 挂载进程跟踪点失败，无法按linuxService进程树过滤流量")
+		} else {
+			c.filterMode = "process_tree"
+			c.logger.Info("✅ 进程树跟踪点已挂载，只上报linuxService及其子进程的流量")
+		}
+	}
+
+	if c.attachMode == AttachModeCgroup {
+		c.logger.Info("📦 cgroup模式：linuxService启动后挂载到其所在cgroup")
+		return nil
+	}
+
+	if err := c.attachInterfaces(); err != nil {
+		c.detachEbpf()
+		return err
+	}
+	return nil
+}
+
+// attachInterfaces 将程序挂载为各接口上的TC egress/ingress分类器
+func (c *ContainerMonitor) attachInterfaces() error {
+	if len(c.interfaceNames) == 0 {
+		names, err := detectDefaultRouteInterfaces()
+		if err != nil {
+			return &EbpfError{Stage: EbpfStageAttach, Program: c.programPath, Err: err}
+		}
+		c.interfaceNames = names
+		c.logger.WithField("interfaces", names).Info("🔍 自动选择默认路由接口")
+	}
+
+	var firstErr error
+	for _, name := range c.interfaceNames {
+		status := InterfaceStatus{Name: name}
+
+		attachment, err := attachTC(name, DirectionClientToProxy, c.objs.TrafficMonitor)
+		if err != nil {
+			status.Err = &EbpfError{Stage: EbpfStageAttach, Program: c.programPath, Interface: name, Err: err}
+			if firstErr == nil {
+				firstErr = status.Err
+			}
+			c.logger.WithError(status.Err).WithField("interface", name).Warn("⚠️ 挂载eBPF程序失败")
+			c.recordInterface(status)
+			continue
+		}
+		status.Attached = true
+		status.Mode = attachment.Mode()
+		attachments := []*tcAttachment{attachment}
+
+		// ingress 挂载失败时仍可依靠客户端报文推断握手结果
+		ingress, err := attachTC(name, DirectionProxyToClient, c.objs.TrafficMonitorIngress)
+		if err != nil {
+			status.Err = &EbpfError{Stage: EbpfStageAttach, Program: c.programPath, Interface: name, Err: err}
+			c.logger.WithError(status.Err).WithField("interface", name).Warn("⚠️ 挂载ingress程序失败，无法观察代理应答")
+		} else {
+			status.Ingress = true
+			attachments = append(attachments, ingress)
+		}
+
+		c.logger.WithFields(logrus.Fields{
+			"interface":   name,
+			"attach_mode": status.Mode,
+			"ingress":     status.Ingress,
+		}).Info("✅ eBPF程序已挂载到TC")
+
+		c.recordInterface(status, attachments...)
+	}
+
+	// 所有接口都挂载失败时视为启动失败
+	if _, attached := c.interfaceAttachments(); attached == 0 {
+		return firstErr
+	}
+	return nil
+}
+
+// recordInterface 记录接口挂载状态和已挂载的分类器
+func (c *ContainerMonitor) recordInterface(status InterfaceStatus, attachments ...*tcAttachment) {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+	c.interfaceStatus = append(c.interfaceStatus, status)
+	c.attachments = append(c.attachments, attachments...)
+}
+
+// interfaceAttachments 返回各接口挂载状态的描述和当前已挂载的分类器数量
+func (c *ContainerMonitor) interfaceAttachments() ([]string, int) {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+	interfaces := make([]string, 0, len(c.interfaceStatus))
+	for _, status := range c.interfaceStatus {
+		interfaces = append(interfaces, status.String())
+	}
+	return interfaces, len(c.attachments)
+}
+
+// detachEbpf 卸载TC分类器和cgroup程序并释放eBPF对象
+func (c *ContainerMonitor) detachEbpf() {
+	c.targetsMu.Lock()
+	// 逆序卸载，保证由egress创建的clsact qdisc最后删除
+	for i := len(c.attachments) - 1; i >= 0; i-- {
+		attachment := c.attachments[i]
+		if err := attachment.Close(); err != nil {
+			c.logger.WithError(&EbpfError{Stage: EbpfStageDetach, Program: c.programPath, Interface: attachment.interfaceName, Err: err}).Warn("⚠️ 卸载eBPF程序失败")
+		}
+	}
+	c.attachments = nil
+
+	if c.cgroup != nil {
+		if err := c.cgroup.Close(); err != nil {
+			c.logger.WithError(&EbpfError{Stage: EbpfStageDetach, Program: c.programPath, Err: err}).WithField("cgroup", c.cgroup.path).Warn("⚠️ 卸载cgroup程序失败")
+		}
+		c.cgroup = nil
+	}
+	if c.objs != nil {
+		if err := c.objs.Close(); err != nil {
+			c.logger.WithError(err).Warn("⚠️ 释放eBPF对象失败")
+		}
+		c.objs = nil
+	}
+	c.targetsMu.Unlock()
+
+	c.logger.Info("🧹 eBPF程序已卸载")
+}
+
+// SetProxyTargets 设置需要监控的代理集合
+// 启动前调用仅保存配置；运行中调用会同步到内核映射和用户空间分类器
+func (c *ContainerMonitor) SetProxyTargets(targets *ProxyTargets) error {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+
+	if c.objs != nil {
+		if err := c.objs.syncProxyTargets(targets); err != nil {
+			return &EbpfError{Stage: EbpfStageMap, Program: c.programPath, Err: err}
+		}
+	}
+	if c.socks5Monitor != nil {
+		c.socks5Monitor.SetProxyTargets(targets)
+	}
+	c.proxyTargets = targets
+
+	c.logger.WithField("proxy_targets", targets.String()).Info("🎯 代理监控集合已更新")
+	return nil
+}
+
+// SetAttachMode 设置挂载方式，需在 Start 之前调用
+func (c *ContainerMonitor) SetAttachMode(mode AttachMode) {
+	c.attachMode = mode
+}
+
+// SetProcessFilter 设置是否只上报 linuxService 进程树发起的连接，需在 Start 之前调用
+func (c *ContainerMonitor) SetProcessFilter(enabled bool) {
+	c.processFilter = enabled
+}
+
+// SetProxyHealthConfig 设置代理健康告警配置，需在 Start 之前调用
+func (c *ContainerMonitor) SetProxyHealthConfig(config ProxyHealthConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	c.healthConfig = config
+	return nil
+}
+
+// SetCredentialRedactor 设置凭据脱敏策略，需在 Start 之前调用
+func (c *ContainerMonitor) SetCredentialRedactor(redactor *CredentialRedactor) {
+	c.redactor = redactor
+}
+
+// SetCredentialVault 设置加密凭据库，需在 Start 之前调用，由调用方负责关闭
+func (c *ContainerMonitor) SetCredentialVault(vault *CredentialVault) {
+	c.vault = vault
+}
+
+// SetEventSinks 设置会话事件接收者，多个时同时分发，需在 Start 之前调用
+func (c *ContainerMonitor) SetEventSinks(sinks ...EventSink) {
+	c.eventSink = nil
+	if len(sinks) > 0 {
+		c.eventSink = MultiEventSink(sinks...)
+	}
+}
+
+// reportCredentialRotation 输出凭据变化事件（只包含指纹）
+func (c *ContainerMonitor) reportCredentialRotation(rotation CredentialRotation) {
+	c.logger.WithFields(logrus.Fields{
+		"alert":                "SOCKS5_CREDENTIAL_ROTATED",
+		"proxy":                rotation.Proxy,
+		"username":             rotation.Username,
+		"fingerprint":          rotation.Current,
+		"previous_fingerprint": rotation.Previous.Fingerprint,
+		"previous_first_seen":  rotation.Previous.FirstSeen.Format(time.RFC3339),
+		"previous_last_seen":   rotation.Previous.LastSeen.Format(time.RFC3339),
+		"previous_sessions":    rotation.Previous.Sessions,
+	}).Warn("🔄 上游SOCKS5代理凭据已更换")
+}
+
+// reportProxyHealth 输出代理健康状态变化告警
+func (c *ContainerMonitor) reportProxyHealth(alert ProxyHealthAlert) {
+	outcomes := make(map[string]int, len(alert.Outcomes))
+	for outcome, n := range alert.Outcomes {
+		outcomes[string(outcome)] = n
+	}
+	entry := c.logger.WithFields(logrus.Fields{
+		"proxy":             alert.Proxy,
+		"failure_rate":      fmt.Sprintf("%.2f", alert.FailureRate),
+		"failure_threshold": alert.Threshold,
+		"window":            alert.Window.String(),
+		"window_sessions":   alert.Sessions,
+		"window_failures":   alert.Failures,
+		"outcomes":          outcomes,
+	})
+	if alert.Unhealthy {
+		entry.WithField("alert", "SOCKS5_PROXY_UNHEALTHY").Error("🚨 上游SOCKS5代理失败率超过阈值")
+		return
+	}
+	entry.WithField("alert", "SOCKS5_PROXY_RECOVERED").Info("✅ 上游SOCKS5代理失败率恢复正常")
+}
+
+// superviseProcess 将新的 linuxService PID 同步到内核进程树和用户空间监控器，cgroup模式下同时跟随其cgroup
+func (c *ContainerMonitor) superviseProcess(pid int) {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+
+	if c.socks5Monitor != nil {
+		c.socks5Monitor.SetTargetPID(pid)
+	}
+	if c.objs == nil {
+		return
+	}
+	if c.attachMode == AttachModeCgroup {
+		c.cgroupErr = c.attachCgroupForPID(pid)
+		if c.cgroupErr != nil {
+			c.logger.WithError(c.cgroupErr).WithField("pid", pid).Error("❌ 挂载到linuxService所在cgroup失败")
+		}
+	}
+	if c.filterMode != "process_tree" {
+		return
+	}
+	if err := c.objs.setSupervisedProcess(pid); err != nil {
+		c.logger.WithError(&EbpfError{Stage: EbpfStageMap, Program: c.programPath, Err: err}).Error("❌ 更新受监控进程树失败")
+		return
+	}
+	c.logger.WithField("pid", pid).Info("🎯 受监控进程树已更新")
+}
+
+// attachCgroupForPID 挂载到进程所在cgroup，cgroup未变化时保留原挂载，调用方持有 targetsMu
+func (c *ContainerMonitor) attachCgroupForPID(pid int) error {
+	path, err := cgroupPathForPID(pid)
+	if err != nil {
+		return err
+	}
+	if c.cgroup != nil && c.cgroup.path == path {
+		return nil
+	}
+
+	attachment, err := attachCgroup(path, c.objs.CgroupEgress, c.objs.CgroupIngress)
+	if err != nil {
+		return fmt.Errorf("cgroup %s: %w", path, err)
+	}
+	if c.cgroup != nil {
+		if err := c.cgroup.Close(); err != nil {
+			c.logger.WithError(&EbpfError{Stage: EbpfStageDetach, Program: c.programPath, Err: err}).WithField("cgroup", c.cgroup.path).Warn("⚠️ 卸载旧cgroup程序失败")
+		}
+	}
+	c.cgroup = attachment
+
+	c.logger.WithField("cgroup", path).Info("✅ eBPF程序已挂载到cgroup (cgroup_skb egress+ingress)")
+	return nil
+}
+
+// flowCounters 从内核流状态查询连接流量和最后活跃时间
+func (c *ContainerMonitor) flowCounters(session *SOCKS5Session) (FlowCounters, bool) {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+	if c.objs == nil {
+		return FlowCounters{}, false
+	}
+	return c.objs.flowCounters(session)
+}
+
+// cgroupPath 返回当前挂载的cgroup路径，未挂载时为空
+func (c *ContainerMonitor) cgroupPath() string {
+	path, _ := c.cgroupStatus()
+	return path
+}
+
+// cgroupStatus 返回当前挂载的cgroup路径和最近一次挂载失败的原因
+func (c *ContainerMonitor) cgroupStatus() (string, error) {
+	c.targetsMu.Lock()
+	defer c.targetsMu.Unlock()
+	if c.cgroup == nil {
+		return "", c.cgroupErr
+	}
+	return c.cgroup.path, c.cgroupErr
+}
+
 // startLinuxService 启动 linuxService 程序
 func (c *ContainerMonitor) startLinuxService(ctx context.Context) error {
 	c.logger.Info("🔧 启动linuxService目标程序...")
@@ -74,10 +491,10 @@ func (c *ContainerMonitor) startLinuxService(ctx context.Context) error {
 	}
 
 	// 创建命令
-	c.linuxServiceCmd = exec.CommandContext(ctx, "./linuxService")
+	cmd := exec.CommandContext(ctx, "./linuxService")
 
 	// 设置环境变量
-	c.linuxServiceCmd.Env = append(os.Environ(),
+	cmd.Env = append(os.Environ(),
 		"REDIS_HOST=redis",
 		"REDIS_PORT=6379",
 		"REDIS_PASSWORD=12399999",
@@ -85,7 +502,7 @@ func (c *ContainerMonitor) startLinuxService(ctx context.Context) error {
 	)
 
 	// 设置进程组
-	c.linuxServiceCmd.SysProcAttr = &syscall.SysProcAttr{
+	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
 
@@ -94,60 +511,85 @@ func (c *ContainerMonitor) startLinuxService(ctx context.Context) error {
 	if err != nil {
 		c.logger.WithError(err).Warn("⚠️ 无法创建linuxService日志文件")
 	} else {
-		c.linuxServiceCmd.Stdout = logFile
-		c.linuxServiceCmd.Stderr = logFile
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
 	}
 
 	// 启动进程
-	if err := c.linuxServiceCmd.Start(); err != nil {
+	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("启动linuxService进程失败: %w", err)
 	}
 
-	// 获取 PID
-	c.linuxServicePID = c.linuxServiceCmd.Process.Pid
-	c.logger.WithField("pid", c.linuxServicePID).Info("✅ linuxService进程启动成功")
+	// 获取 PID，健康检查和指标在其他协程中读取
+	pid := cmd.Process.Pid
+	c.linuxServiceCmd.Store(cmd)
+	c.linuxServicePID.Store(int64(pid))
+	c.serviceDownAt.Store(0)
+	c.logger.WithField("pid", pid).Info("✅ linuxService进程启动成功")
+
+	// 内核只上报新进程树发起的连接
+	c.superviseProcess(pid)
 
 	// 监控进程状态
-	go c.monitorLinuxServiceProcess(ctx)
+	go c.monitorLinuxServiceProcess(ctx, cmd)
 
 	return nil
 }
 
-// monitorLinuxServiceProcess 监控 linuxService 进程状态
-func (c *ContainerMonitor) monitorLinuxServiceProcess(ctx context.Context) {
-	if c.linuxServiceCmd == nil {
+// monitorLinuxServiceProcess 监控 linuxService 进程状态，异常退出时自动重启
+func (c *ContainerMonitor) monitorLinuxServiceProcess(ctx context.Context, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	c.linuxServicePID.Store(0)
+	c.serviceDownAt.Store(time.Now().UnixNano())
+	exit := "exited"
+	if err != nil {
+		exit = err.Error()
+	}
+	c.serviceLastExit.Store(&exit)
+	if ctx.Err() != nil {
 		return
 	}
+	c.logger.WithError(err).Warn("⚠️ linuxService进程异常退出")
 
-	err := c.linuxServiceCmd.Wait()
-	if err != nil && ctx.Err() == nil {
-		c.logger.WithError(err).Warn("⚠️ linuxService进程异常退出")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(linuxServiceRestartDelay):
+		}
+
+		c.serviceRestarts.Add(1)
+		if err := c.startLinuxService(ctx); err != nil {
+			c.logger.WithError(err).Error("❌ 重启linuxService失败")
+			continue
+		}
+		return
 	}
-	c.linuxServicePID = 0
 }
 
 // stopLinuxService 停止 linuxService 进程
 func (c *ContainerMonitor) stopLinuxService() {
-	if c.linuxServiceCmd == nil || c.linuxServiceCmd.Process == nil {
+	cmd := c.linuxServiceCmd.Load()
+	if cmd == nil || cmd.Process == nil {
 		return
 	}
 
-	c.logger.WithField("pid", c.linuxServicePID).Info("🛑 停止linuxService进程...")
+	c.logger.WithField("pid", cmd.Process.Pid).Info("🛑 停止linuxService进程...")
 
 	// 发送 SIGTERM 信号
-	if err := c.linuxServiceCmd.Process.Signal(syscall.SIGTERM); err != nil {
-		c.linuxServiceCmd.Process.Kill()
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
 	}
 
 	// 等待进程退出
 	done := make(chan error, 1)
 	go func() {
-		done <- c.linuxServiceCmd.Wait()
+		done <- cmd.Wait()
 	}()
 
 	select {
 	case <-time.After(5 * time.Second):
-		c.linuxServiceCmd.Process.Kill()
+		cmd.Process.Kill()
 	case <-done:
 		c.logger.Info("✅ linuxService进程已停止")
 	}
@@ -157,9 +599,6 @@ func (c *ContainerMonitor) stopLinuxService() {
 func (c *ContainerMonitor) startEnhancedSOCKS5Monitor(ctx context.Context, interval time.Duration) {
 	c.logger.Info("🔐 启动增强SOCKS5监控（专注linuxService进程）...")
 
-	// 创建增强SOCKS5监控器，专注于linuxService进程
-	monitor := NewEnhancedSOCKS5Monitor(c.linuxServicePID)
-
 	// 启动定时清理和检查
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -171,7 +610,7 @@ func (c *ContainerMonitor) startEnhancedSOCKS5Monitor(ctx context.Context, inter
 			return
 		case <-ticker.C:
 			// 清理过期会话
-			monitor.CleanupSessions()
+			c.socks5Monitor.CleanupSessions()
 		}
 	}
 }
@@ -194,21 +633,79 @@ func (c *ContainerMonitor) startStatusReporter(ctx context.Context, interval tim
 
 // reportStatus 报告监控状态
 func (c *ContainerMonitor) reportStatus() {
-	isRunning := c.linuxServicePID > 0 && c.linuxServiceCmd != nil && c.linuxServiceCmd.Process != nil
-
-	if !isRunning {
+	if !c.linuxServiceRunning() {
 		c.logger.WithField("alert", "LINUX_SERVICE_DOWN").Error("❌ linuxService进程未运行")
 	} else {
-		c.logger.WithFields(logrus.Fields{
+		fields := logrus.Fields{
 			"alert":             "CONTAINER_MONITORING_ACTIVE",
-			"linux_service_pid": c.linuxServicePID,
+			"linux_service_pid": c.GetLinuxServicePID(),
 			"monitoring_status": "active",
 			"container_mode":    true,
-		}).Info("✅ 容器内监控活跃 - 专注linuxService进程")
+		}
+		fields["attach_mode"] = c.attachMode
+		if c.attachMode == AttachModeCgroup {
+			fields["cgroup"] = c.cgroupPath()
+		} else {
+			fields["interfaces"], _ = c.interfaceAttachments()
+		}
+		fields["pid_attribution"] = c.attributionMode
+		fields["process_filter"] = c.filterMode
+		fields["linux_service_restarts"] = c.serviceRestarts.Load()
+		if c.eventReader != nil {
+			stats := c.eventReader.Stats()
+			fields["events_received"] = stats.Received
+			fields["events_lost"] = stats.Lost
+			fields["events_invalid"] = stats.Invalid
+		}
+		if c.socks5Monitor != nil {
+			reassembly := c.socks5Monitor.ReassemblyStats()
+			fields["tcp_retransmits"] = reassembly.Retransmits
+			fields["tcp_out_of_order"] = reassembly.OutOfOrder
+			fields["tcp_gaps"] = reassembly.Gaps
+			fields["tcp_reassembly_bytes"] = reassembly.BufferedBytes
+
+			traffic := make([]string, 0)
+			for _, proxy := range c.socks5Monitor.ProxyTraffic() {
+				traffic = append(traffic, fmt.Sprintf("%s sessions=%d active=%d up=%dB/%dpkt down=%dB/%dpkt",
+					proxy.Proxy, proxy.Sessions, proxy.Active, proxy.BytesUp, proxy.PacketsUp, proxy.BytesDown, proxy.PacketsDown))
+			}
+			fields["proxy_traffic"] = traffic
+
+			latency := make([]string, 0)
+			for _, proxy := range c.socks5Monitor.ProxyLatency() {
+				parts := make([]string, 0, len(latencyMetrics))
+				for _, metric := range latencyMetrics {
+					if p, ok := proxy.Metrics[metric]; ok {
+						parts = append(parts, fmt.Sprintf("%s p50=%s p90=%s p99=%s n=%d", metric, p.P50, p.P90, p.P99, p.Count))
+					}
+				}
+				latency = append(latency, proxy.Proxy+" "+strings.Join(parts, ", "))
+			}
+			fields["proxy_latency"] = latency
+
+			health := make([]string, 0)
+			for _, proxy := range c.socks5Monitor.ProxyHealth() {
+				replies := make([]string, 0, len(proxy.ReplyCodes))
+				for code, n := range proxy.ReplyCodes {
+					if !code.Succeeded() {
+						replies = append(replies, fmt.Sprintf("%s=%d", code, n))
+					}
+				}
+				sort.Strings(replies)
+				status := "healthy"
+				if proxy.Unhealthy {
+					status = "unhealthy"
+				}
+				health = append(health, fmt.Sprintf("%s %s ok=%d fail=%d auth_fail=%d window_failure_rate=%.2f rep_errors=[%s]",
+					proxy.Proxy, status, proxy.Successes, proxy.Failures, proxy.AuthFailures, proxy.Window.FailureRate, strings.Join(replies, ",")))
+			}
+			fields["proxy_health"] = health
+		}
+		c.logger.WithFields(fields).Info("✅ 容器内监控活跃 - 专注linuxService进程")
 	}
 }
 
 // GetLinuxServicePID 获取linuxService的PID
 func (c *ContainerMonitor) GetLinuxServicePID() int {
-	return c.linuxServicePID
+	return int(c.linuxServicePID.Load())
 }
@@ -0,0 +1,98 @@
+package interceptor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// 凭据指纹参数
+const (
+	fingerprintPrefix = "hmac:"
+	fingerprintHexLen = 16 // HMAC-SHA256 前8字节，足以区分不同的凭据
+	minFingerprintKey = 16 // 指纹密钥最少字节数
+)
+
+// CredentialRedactor 凭据脱敏策略：默认显示用户名，密码替换为带密钥的HMAC指纹
+// 同一密钥下相同的用户名和密码得到相同的指纹，可以判断会话使用的是哪组凭据而不泄露密码
+type CredentialRedactor struct {
+	key       []byte
+	reveal    bool // 明确要求时输出明文密码
+	ephemeral bool // 密钥为进程内随机生成，重启后指纹不可比较
+}
+
+// NewCredentialRedactor 创建脱敏策略，key 为空时随机生成进程内密钥
+func NewCredentialRedactor(key []byte, reveal bool) (*CredentialRedactor, error) {
+	r := &CredentialRedactor{reveal: reveal}
+	if len(key) == 0 {
+		r.key = make([]byte, 32)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, fmt.Errorf("生成指纹密钥失败: %w", err)
+		}
+		r.ephemeral = true
+		return r, nil
+	}
+	if len(key) < minFingerprintKey {
+		return nil, fmt.Errorf("指纹密钥过短: %d 字节，至少需要 %d 字节", len(key), minFingerprintKey)
+	}
+	r.key = append([]byte(nil), key...)
+	return r, nil
+}
+
+// defaultCredentialRedactor 进程内随机密钥、不显示明文
+func defaultCredentialRedactor() *CredentialRedactor {
+	r, err := NewCredentialRedactor(nil, false)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Reveal 是否输出明文密码
+func (r *CredentialRedactor) Reveal() bool {
+	return r.reveal
+}
+
+// Ephemeral 指纹密钥是否为进程内随机生成
+func (r *CredentialRedactor) Ephemeral() bool {
+	return r.ephemeral
+}
+
+// Fingerprint 计算凭据指纹，用户名参与计算，不同用户的相同密码指纹不同
+func (r *CredentialRedactor) Fingerprint(username, password string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return fingerprintPrefix + hex.EncodeToString(mac.Sum(nil))[:fingerprintHexLen]
+}
+
+// Password 返回可以写入日志的密码：明文或指纹
+func (r *CredentialRedactor) Password(username, password string) string {
+	if r.reveal {
+		return password
+	}
+	return r.Fingerprint(username, password)
+}
+
+// SetCredentialRedactor 设置凭据脱敏策略，为 nil 时恢复默认策略
+func (m *EnhancedSOCKS5Monitor) SetCredentialRedactor(redactor *CredentialRedactor) {
+	if redactor == nil {
+		redactor = defaultCredentialRedactor()
+	}
+	m.redactor.Store(redactor)
+}
+
+// recordCredentials 保存提取到的凭据并计算指纹，返回可以写入日志的密码（调用方需持有分片锁）
+// 凭据库只在锁内加密排队，写盘由凭据库的写入协程完成
+func (m *EnhancedSOCKS5Monitor) recordCredentials(session *SOCKS5Session, username, password string) string {
+	redactor := m.redactor.Load()
+	session.Username = username
+	session.Password = password
+	session.PasswordFingerprint = redactor.Fingerprint(username, password)
+	m.observeCredential(session)
+	m.storeCredentials(session)
+	return redactor.Password(username, password)
+}
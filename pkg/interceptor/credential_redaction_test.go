@@ -0,0 +1,150 @@
+package interceptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+var testFingerprintKey = []byte("0123456789abcdef-fingerprint")
+
+func TestCredentialFingerprint(t *testing.T) {
+	r1, err := NewCredentialRedactor(testFingerprintKey, false)
+	if err != nil {
+		t.Fatalf("NewCredentialRedactor: %v", err)
+	}
+	r2, err := NewCredentialRedactor(testFingerprintKey, true)
+	if err != nil {
+		t.Fatalf("NewCredentialRedactor: %v", err)
+	}
+	other, err := NewCredentialRedactor([]byte("fedcba9876543210-fingerprint"), false)
+	if err != nil {
+		t.Fatalf("NewCredentialRedactor: %v", err)
+	}
+
+	base := r1.Fingerprint("alice", "secret")
+	if !strings.HasPrefix(base, fingerprintPrefix) || len(base) != len(fingerprintPrefix)+fingerprintHexLen {
+		t.Fatalf("Fingerprint = %q, want %s followed by %d hex digits", base, fingerprintPrefix, fingerprintHexLen)
+	}
+
+	cases := []struct {
+		name string
+		got  string
+		same bool
+	}{
+		{"same key and credentials", r1.Fingerprint("alice", "secret"), true},
+		{"same key, reveal does not change fingerprint", r2.Fingerprint("alice", "secret"), true},
+		{"different key", other.Fingerprint("alice", "secret"), false},
+		{"different password", r1.Fingerprint("alice", "secret2"), false},
+		{"different username", r1.Fingerprint("bob", "secret"), false},
+		{"username and password boundary", r1.Fingerprint("alices", "ecret"), false},
+	}
+	for _, tc := range cases {
+		if (tc.got == base) != tc.same {
+			t.Errorf("%s: Fingerprint = %q, base %q, want equal %v", tc.name, tc.got, base, tc.same)
+		}
+	}
+
+	// 未提供密钥时每个进程随机生成，指纹不可跨进程比较
+	e1, _ := NewCredentialRedactor(nil, false)
+	e2, _ := NewCredentialRedactor(nil, false)
+	if !e1.Ephemeral() || e1.Fingerprint("alice", "secret") == e2.Fingerprint("alice", "secret") {
+		t.Error("ephemeral redactors produced the same fingerprint")
+	}
+	if _, err := NewCredentialRedactor([]byte("short"), false); err == nil {
+		t.Error("NewCredentialRedactor(short key) succeeded")
+	}
+}
+
+func TestCredentialRedaction(t *testing.T) {
+	const password = "pl41n-s3cret"
+
+	cases := []struct {
+		name   string
+		reveal bool
+	}{
+		{"redacted", false},
+		{"revealed", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := log.Writer()
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(previous) })
+
+			redactor, err := NewCredentialRedactor(testFingerprintKey, tc.reveal)
+			if err != nil {
+				t.Fatalf("NewCredentialRedactor: %v", err)
+			}
+			var banner, jsonl, structured bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&structured)
+			logger.SetFormatter(&logrus.JSONFormatter{})
+
+			var events []SessionEvent
+			m := newTestMonitor()
+			m.SetCredentialRedactor(redactor)
+			m.SetEventSink(MultiEventSink(
+				NewBannerEventSink(&banner),
+				NewJSONLinesEventSink(&jsonl),
+				NewLogrusEventSink(logrus.NewEntry(logger)),
+				EventSinkFunc(func(event SessionEvent) { events = append(events, event) }),
+			))
+			handshake(m, "10.0.1.1", 40001, "alice", password, 0x00)
+
+			fingerprint := redactor.Fingerprint("alice", password)
+			outputs := map[string]string{
+				"log":    logs.String(),
+				"banner": banner.String(),
+				"jsonl":  jsonl.String(),
+				"logrus": structured.String(),
+			}
+			for name, out := range outputs {
+				if got := strings.Contains(out, password); got != tc.reveal {
+					t.Errorf("%s contains plaintext = %v, want %v:\n%s", name, got, tc.reveal, out)
+				}
+				if !tc.reveal && !strings.Contains(out, fingerprint) {
+					t.Errorf("%s does not contain fingerprint %s:\n%s", name, fingerprint, out)
+				}
+			}
+
+			// 事件快照中不带会话的明文密码字段，只按策略填写 Password
+			want := fingerprint
+			if tc.reveal {
+				want = password
+			}
+			var authenticated int
+			for _, event := range events {
+				if event.Session.Password != "" {
+					t.Errorf("%s event carries session password %q", event.Type, event.Session.Password)
+				}
+				if event.Session.Username == "" {
+					continue
+				}
+				if event.Password != want || event.Revealed != tc.reveal {
+					t.Errorf("%s event password = %q (revealed %v), want %q (revealed %v)", event.Type, event.Password, event.Revealed, want, tc.reveal)
+				}
+				if event.Type == EventAuthenticated {
+					authenticated++
+				}
+			}
+			if authenticated == 0 {
+				t.Error("no authenticated event")
+			}
+
+			// 凭据历史只保存指纹，与是否显示明文无关
+			history, err := json.Marshal(m.CredentialHistory())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(history), password) || !strings.Contains(string(history), fingerprint) {
+				t.Errorf("CredentialHistory = %s, want fingerprint %s only", history, fingerprint)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxCredentialHistory 每个 代理+用户名 保留的凭据记录数，超出后丢弃最旧的
+const maxCredentialHistory = 16
+
+// DefaultCredentialsAddr 凭据历史端点的默认监听地址，只允许本机访问
+const DefaultCredentialsAddr = "127.0.0.1:9101"
+
+// CredentialRecord 一组凭据（按指纹区分）的使用区间，不含明文密码
+type CredentialRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Sessions    uint64    `json:"sessions"` // 使用该凭据的会话数
+}
+
+// CredentialHistory 单个 代理+用户名 的凭据变化历史，Records 按时间先后排列，最后一项为当前凭据
+type CredentialHistory struct {
+	Proxy     string             `json:"proxy"`
+	Username  string             `json:"username"`
+	Rotations uint64             `json:"rotations"`
+	Records   []CredentialRecord `json:"records"`
+}
+
+// CredentialRotation 凭据变化事件
+type CredentialRotation struct {
+	Proxy    string
+	Username string
+	At       time.Time
+	Previous CredentialRecord // 被替换的凭据
+	Current  string           // 新凭据的指纹
+}
+
+// CredentialRotationHandler 接收凭据变化事件
+type CredentialRotationHandler func(rotation CredentialRotation)
+
+// credentialKey 按代理和用户名区分凭据
+type credentialKey struct {
+	proxy    string
+	username string
+}
+
+// credentialHistory 凭据变化历史
+type credentialHistory struct {
+	rotations uint64
+	records   []CredentialRecord
+}
+
+// SetCredentialRotationHandler 设置凭据变化事件的接收者，为 nil 时只写日志
+func (m *EnhancedSOCKS5Monitor) SetCredentialRotationHandler(handler CredentialRotationHandler) {
+	m.credMu.Lock()
+	defer m.credMu.Unlock()
+	m.rotationHandler = handler
+}
+
+// observeCredential 按 代理+用户名 记录凭据指纹，指纹与上一次不同时发出凭据变化事件
+func (m *EnhancedSOCKS5Monitor) observeCredential(session *SOCKS5Session) {
+	key := credentialKey{proxy: joinHostPort(session.ProxyIP, session.ProxyPort), username: session.Username}
+	now := time.Now()
+
+	m.credMu.Lock()
+	if m.credentials == nil {
+		m.credentials = make(map[credentialKey]*credentialHistory)
+	}
+	history, ok := m.credentials[key]
+	if !ok {
+		history = &credentialHistory{}
+		m.credentials[key] = history
+	}
+
+	var rotation *CredentialRotation
+	if n := len(history.records); n > 0 && history.records[n-1].Fingerprint == session.PasswordFingerprint {
+		current := &history.records[n-1]
+		current.LastSeen = now
+		current.Sessions++
+	} else {
+		if n > 0 {
+			history.rotations++
+			rotation = &CredentialRotation{
+				Proxy:    key.proxy,
+				Username: key.username,
+				At:       now,
+				Previous: history.records[n-1],
+				Current:  session.PasswordFingerprint,
+			}
+		}
+		history.records = append(history.records, CredentialRecord{
+			Fingerprint: session.PasswordFingerprint,
+			FirstSeen:   now,
+			LastSeen:    now,
+			Sessions:    1,
+		})
+		if len(history.records) > maxCredentialHistory {
+			history.records = history.records[len(history.records)-maxCredentialHistory:]
+		}
+	}
+	handler := m.rotationHandler
+	m.credMu.Unlock()
+
+	if rotation == nil {
+		return
+	}
+	if handler != nil {
+		handler(*rotation)
+		return
+	}
+	log.Printf("🔄 [SOCKS5-凭据变化] 代理 %s 用户 '%s' 的密码已更换: %s -> %s (旧凭据使用 %d 个会话)",
+		rotation.Proxy, rotation.Username, rotation.Previous.Fingerprint, rotation.Current, rotation.Previous.Sessions)
+}
+
+// CredentialHistory 返回所有 代理+用户名 的凭据变化历史，按代理和用户名排序
+func (m *EnhancedSOCKS5Monitor) CredentialHistory() []CredentialHistory {
+	m.credMu.Lock()
+	defer m.credMu.Unlock()
+
+	result := make([]CredentialHistory, 0, len(m.credentials))
+	for key, history := range m.credentials {
+		result = append(result, CredentialHistory{
+			Proxy:     key.proxy,
+			Username:  key.username,
+			Rotations: history.rotations,
+			Records:   append([]CredentialRecord(nil), history.records...),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Proxy != result[j].Proxy {
+			return result[i].Proxy < result[j].Proxy
+		}
+		return result[i].Username < result[j].Username
+	})
+	return result
+}
+
+// SetCredentialsAddr 设置凭据历史端点 /credentials 的监听地址，为空时不启动，需在 Start 之前调用
+// 该端点没有认证，与 /metrics 分开监听，默认只应绑定本机地址
+func (c *ContainerMonitor) SetCredentialsAddr(addr string) {
+	c.credentialsAddr = addr
+}
+
+// startCredentialsServer 启动凭据历史端点，上下文取消后关闭
+func (c *ContainerMonitor) startCredentialsServer(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/credentials", c.handleCredentials)
+	addr, err := c.serveHTTP(ctx, c.credentialsAddr, mux)
+	if err != nil {
+		return fmt.Errorf("监听凭据历史端点失败 (%s): %w", c.credentialsAddr, err)
+	}
+
+	entry := c.logger.WithField("addr", addr.String())
+	if !isLoopbackAddr(addr) {
+		entry.Warn("⚠️ 凭据历史端点监听在非本机地址且没有认证，其他主机可以读取凭据指纹和用户名")
+	}
+	entry.Info("🔄 凭据历史端点已启动 (/credentials)")
+	return nil
+}
+
+// isLoopbackAddr 监听地址是否只接受本机连接
+func isLoopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// handleCredentials 以JSON输出凭据变化历史（只有指纹）
+func (c *ContainerMonitor) handleCredentials(w http.ResponseWriter, r *http.Request) {
+	history := []CredentialHistory{}
+	if c.socks5Monitor != nil {
+		history = c.socks5Monitor.CredentialHistory()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(history)
+}
@@ -0,0 +1,84 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCredentialsEndpoint(t *testing.T) {
+	m := newTestMonitor()
+	handshake(m, "10.0.1.1", 40001, "alice", "secret1", 0x00)
+	handshake(m, "10.0.1.1", 40002, "alice", "secret2", 0x00)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c := &ContainerMonitor{socks5Monitor: m, logger: logrus.NewEntry(logger)}
+
+	// 先占用一个本机端口再释放，得到可用的监听地址
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.SetCredentialsAddr(addr)
+	if err := c.startCredentialsServer(ctx); err != nil {
+		t.Fatalf("startCredentialsServer: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/credentials")
+	if err != nil {
+		t.Fatalf("GET /credentials: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+
+	var history []CredentialHistory
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(history) != 1 || history[0].Username != "alice" || history[0].Rotations != 1 || len(history[0].Records) != 2 {
+		t.Fatalf("history = %+v, want alice with 1 rotation and 2 records", history)
+	}
+	for _, record := range history[0].Records {
+		if record.Fingerprint == "" || record.Fingerprint == "secret1" || record.Fingerprint == "secret2" {
+			t.Errorf("record fingerprint = %q, want redacted fingerprint", record.Fingerprint)
+		}
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	cases := []struct {
+		addr net.Addr
+		want bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9101}, true},
+		{&net.TCPAddr{IP: net.ParseIP("::1"), Port: 9101}, true},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 9101}, false},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 9101}, false},
+		{&net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 9101}, false},
+		{&net.UnixAddr{Name: "/tmp/credentials.sock", Net: "unix"}, false},
+	}
+	for _, tc := range cases {
+		if got := isLoopbackAddr(tc.addr); got != tc.want {
+			t.Errorf("isLoopbackAddr(%s) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+	if host, _, _ := net.SplitHostPort(DefaultCredentialsAddr); !net.ParseIP(host).IsLoopback() {
+		t.Errorf("DefaultCredentialsAddr = %s, want a loopback address", DefaultCredentialsAddr)
+	}
+}
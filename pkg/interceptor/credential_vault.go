@@ -0,0 +1,394 @@
+package interceptor
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 凭据库文件格式：首行为文件头，之后每行一条记录（JSON Lines）
+// 用户名和密码以 AES-256-GCM 加密，会话ID、代理等元数据为明文并作为附加数据参与认证
+// 加密密钥由密钥材料经 PBKDF2-HMAC-SHA256 派生，盐和迭代次数保存在文件头中
+const (
+	vaultVersion  = 2
+	vaultCipher   = "aes-256-gcm"
+	vaultKDF      = "pbkdf2-sha256"
+	vaultSaltSize = 16
+	vaultKeyCheck = "wx-proxy-vault" // 文件头中加密保存，用于校验密钥
+	vaultFileMode = 0o600
+	vaultDirMode  = 0o700
+	minVaultKey   = 16  // 密钥材料最少字节数
+	vaultQueue    = 256 // 等待写入的记录数上限
+)
+
+// vaultIterations 新建凭据库的 PBKDF2 迭代次数，已有凭据库以文件头中的次数为准
+var vaultIterations = 600_000
+
+// ErrVaultKey 密钥与凭据库不匹配
+var ErrVaultKey = errors.New("凭据库密钥错误")
+
+// vaultHeader 凭据库文件头
+type vaultHeader struct {
+	Version    int    `json:"version"`
+	Cipher     string `json:"cipher"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	KeyCheck   sealed `json:"key_check"`
+}
+
+// vaultRecord 凭据库中的一条记录
+type vaultRecord struct {
+	SessionID   string    `json:"session_id"`
+	Proxy       string    `json:"proxy"`
+	Client      string    `json:"client"`
+	Fingerprint string    `json:"fingerprint"`
+	CapturedAt  time.Time `json:"captured_at"`
+	Credentials sealed    `json:"credentials"`
+}
+
+// sealed 加密后的数据
+type sealed struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// vaultCredentials 加密前的凭据字段
+type vaultCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// VaultEntry 解密后的凭据记录
+type VaultEntry struct {
+	SessionID   string
+	Proxy       string
+	Client      string
+	Fingerprint string
+	CapturedAt  time.Time
+	Username    string
+	Password    string
+}
+
+// CredentialVault 本地加密凭据库，只追加写入
+// 记录在调用方加密后交给写入协程，写盘和 fsync 不阻塞事件处理
+type CredentialVault struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File // 打开后只由写入协程使用
+	aead    cipher.AEAD
+	records chan vaultRecord
+	closed  bool
+	done    chan struct{}
+}
+
+// checkVaultKey 检查密钥材料长度
+func checkVaultKey(key []byte) error {
+	if len(key) < minVaultKey {
+		return fmt.Errorf("凭据库密钥过短: %d 字节，至少需要 %d 字节", len(key), minVaultKey)
+	}
+	return nil
+}
+
+// newVaultHeader 生成新凭据库的文件头：随机盐，派生密钥并加密校验值
+func newVaultHeader(key []byte) (vaultHeader, cipher.AEAD, error) {
+	header := vaultHeader{
+		Version:    vaultVersion,
+		Cipher:     vaultCipher,
+		KDF:        vaultKDF,
+		Salt:       make([]byte, vaultSaltSize),
+		Iterations: vaultIterations,
+	}
+	if _, err := rand.Read(header.Salt); err != nil {
+		return header, nil, fmt.Errorf("生成随机盐失败: %w", err)
+	}
+	aead, err := header.deriveAEAD(key)
+	if err != nil {
+		return header, nil, err
+	}
+	if header.KeyCheck, err = seal(aead, []byte(vaultKeyCheck), nil); err != nil {
+		return header, nil, err
+	}
+	return header, aead, nil
+}
+
+// deriveAEAD 按文件头中的参数由密钥材料派生 AES-256 密钥
+func (h *vaultHeader) deriveAEAD(key []byte) (cipher.AEAD, error) {
+	derived, err := pbkdf2.Key(sha256.New, string(key), h.Salt, h.Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("派生凭据库密钥失败: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// unlock 派生密钥并用文件头中的校验值确认密钥正确
+func (h *vaultHeader) unlock(key []byte) (cipher.AEAD, error) {
+	aead, err := h.deriveAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := h.KeyCheck.open(aead, nil); err != nil || string(check) != vaultKeyCheck {
+		return nil, ErrVaultKey
+	}
+	return aead, nil
+}
+
+// seal 加密，附加数据不加密但参与认证
+func seal(aead cipher.AEAD, plaintext, additional []byte) (sealed, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sealed{}, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return sealed{Nonce: nonce, Ciphertext: aead.Seal(nil, nonce, plaintext, additional)}, nil
+}
+
+// open 解密并校验附加数据
+func (s sealed) open(aead cipher.AEAD, additional []byte) ([]byte, error) {
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("随机数长度错误: %d", len(s.Nonce))
+	}
+	return aead.Open(nil, s.Nonce, s.Ciphertext, additional)
+}
+
+// additionalData 记录元数据，防止密文被移到其他记录下
+func (r *vaultRecord) additionalData() []byte {
+	return []byte(r.SessionID + "\x00" + r.Proxy + "\x00" + r.Client + "\x00" + r.Fingerprint + "\x00" + r.CapturedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// OpenCredentialVault 打开或创建凭据库，文件权限强制为 0600、目录为 0700
+// 已存在的凭据库必须使用创建时的密钥
+func OpenCredentialVault(path string, key []byte) (*CredentialVault, error) {
+	if err := checkVaultKey(key); err != nil {
+		return nil, err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, vaultDirMode); err != nil {
+			return nil, fmt.Errorf("创建凭据库目录失败: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, vaultFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("打开凭据库失败: %w", err)
+	}
+	// 文件可能在更宽松的权限下被预先创建
+	if err := file.Chmod(vaultFileMode); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("设置凭据库权限失败: %w", err)
+	}
+
+	v := &CredentialVault{path: path, file: file}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取凭据库信息失败: %w", err)
+	}
+	if info.Size() == 0 {
+		var header vaultHeader
+		if header, v.aead, err = newVaultHeader(key); err == nil {
+			err = v.writeLine(header)
+		}
+	} else {
+		var header vaultHeader
+		if header, err = readVaultHeader(bufio.NewReader(io.NewSectionReader(file, 0, info.Size()))); err == nil {
+			v.aead, err = header.unlock(key)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	v.records = make(chan vaultRecord, vaultQueue)
+	v.done = make(chan struct{})
+	go v.writeLoop()
+	return v, nil
+}
+
+// writeLoop 依次写入排队的记录，Close 关闭队列后写完剩余记录退出
+func (v *CredentialVault) writeLoop() {
+	defer close(v.done)
+	for record := range v.records {
+		if err := v.writeLine(record); err != nil {
+			log.Printf("❌ [SOCKS5-凭据库] 会话 %s 凭据写入失败: %v", record.SessionID, err)
+		}
+	}
+}
+
+// writeLine 追加一行JSON并同步到磁盘
+func (v *CredentialVault) writeLine(value any) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if _, err := v.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入凭据库失败: %w", err)
+	}
+	return v.file.Sync()
+}
+
+// Store 加密会话的用户名和密码并排队写入，队列已满时丢弃并返回错误
+func (v *CredentialVault) Store(session *SOCKS5Session) error {
+	record := vaultRecord{
+		SessionID:   session.SessionID,
+		Proxy:       joinHostPort(session.ProxyIP, session.ProxyPort),
+		Client:      joinHostPort(session.ClientIP, session.ClientPort),
+		Fingerprint: session.PasswordFingerprint,
+		CapturedAt:  time.Now().UTC(),
+	}
+	plaintext, err := json.Marshal(vaultCredentials{Username: session.Username, Password: session.Password})
+	if err != nil {
+		return err
+	}
+	if record.Credentials, err = seal(v.aead, plaintext, record.additionalData()); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return errors.New("凭据库已关闭")
+	}
+	select {
+	case v.records <- record:
+		return nil
+	default:
+		return fmt.Errorf("凭据库写入队列已满(%d 条)，记录被丢弃", vaultQueue)
+	}
+}
+
+// Path 凭据库文件路径
+func (v *CredentialVault) Path() string {
+	return v.path
+}
+
+// Close 写完已排队的记录后关闭凭据库文件
+func (v *CredentialVault) Close() error {
+	v.mu.Lock()
+	if v.closed {
+		v.mu.Unlock()
+		return nil
+	}
+	v.closed = true
+	close(v.records)
+	v.mu.Unlock()
+
+	<-v.done
+	return v.file.Close()
+}
+
+// ReadCredentialVault 用密钥解密凭据库中的全部记录
+func ReadCredentialVault(path string, key []byte) ([]VaultEntry, error) {
+	if err := checkVaultKey(key); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开凭据库失败: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, err := readVaultHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := header.unlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []VaultEntry
+	for line := 2; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			entry, decodeErr := decodeVaultRecord(data, aead)
+			if decodeErr != nil {
+				return entries, fmt.Errorf("凭据库第 %d 行: %w", line, decodeErr)
+			}
+			entries = append(entries, entry)
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("读取凭据库失败: %w", err)
+		}
+	}
+}
+
+// readVaultHeader 读取并检查文件头，密钥由调用方通过 unlock 校验
+func readVaultHeader(reader *bufio.Reader) (vaultHeader, error) {
+	var header vaultHeader
+	data, err := reader.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return header, fmt.Errorf("读取凭据库文件头失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return header, fmt.Errorf("凭据库文件头格式错误: %w", err)
+	}
+	if header.Version != vaultVersion || header.Cipher != vaultCipher || header.KDF != vaultKDF {
+		return header, fmt.Errorf("不支持的凭据库格式: version=%d cipher=%s kdf=%s", header.Version, header.Cipher, header.KDF)
+	}
+	if len(header.Salt) < vaultSaltSize || header.Iterations <= 0 {
+		return header, fmt.Errorf("凭据库密钥派生参数错误: salt=%d 字节 iterations=%d", len(header.Salt), header.Iterations)
+	}
+	return header, nil
+}
+
+// decodeVaultRecord 解析并解密一条记录
+func decodeVaultRecord(data []byte, aead cipher.AEAD) (VaultEntry, error) {
+	var record vaultRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return VaultEntry{}, fmt.Errorf("记录格式错误: %w", err)
+	}
+	plaintext, err := record.Credentials.open(aead, record.additionalData())
+	if err != nil {
+		return VaultEntry{}, fmt.Errorf("记录解密失败: %w", err)
+	}
+	var credentials vaultCredentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return VaultEntry{}, fmt.Errorf("记录内容错误: %w", err)
+	}
+	return VaultEntry{
+		SessionID:   record.SessionID,
+		Proxy:       record.Proxy,
+		Client:      record.Client,
+		Fingerprint: record.Fingerprint,
+		CapturedAt:  record.CapturedAt,
+		Username:    credentials.Username,
+		Password:    credentials.Password,
+	}, nil
+}
+
+// SetCredentialVault 设置加密凭据库，提取到凭据时写入，为 nil 时不保存
+func (m *EnhancedSOCKS5Monitor) SetCredentialVault(vault *CredentialVault) {
+	m.vault.Store(vault)
+}
+
+// storeCredentials 将会话凭据写入凭据库（未配置时跳过）
+func (m *EnhancedSOCKS5Monitor) storeCredentials(session *SOCKS5Session) {
+	vault := m.vault.Load()
+	if vault == nil {
+		return
+	}
+	if err := vault.Store(session); err != nil {
+		log.Printf("❌ [SOCKS5-凭据库] 会话 %s 凭据写入失败: %v", session.SessionID, err)
+	}
+}
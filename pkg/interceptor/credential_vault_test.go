@@ -0,0 +1,257 @@
+package interceptor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var testVaultKey = []byte("0123456789abcdef-vault-key")
+
+// vaultSession 已提取到凭据的会话
+func vaultSession(port uint16, username, password string) *SOCKS5Session {
+	return &SOCKS5Session{
+		SessionID:           sessionKeyOf("10.0.1.1", port, "10.0.0.9", 1080),
+		ClientIP:            "10.0.1.1",
+		ClientPort:          port,
+		ProxyIP:             "10.0.0.9",
+		ProxyPort:           1080,
+		Username:            username,
+		Password:            password,
+		PasswordFingerprint: "hmac:" + username,
+	}
+}
+
+// fastVaultKDF 测试期间降低新建凭据库的迭代次数
+func fastVaultKDF(t *testing.T) {
+	iterations := vaultIterations
+	vaultIterations = 1000
+	t.Cleanup(func() { vaultIterations = iterations })
+}
+
+// writeTestVault 创建凭据库并写入会话凭据
+func writeTestVault(t *testing.T, path string, sessions ...*SOCKS5Session) {
+	t.Helper()
+	vault, err := OpenCredentialVault(path, testVaultKey)
+	if err != nil {
+		t.Fatalf("OpenCredentialVault: %v", err)
+	}
+	for _, session := range sessions {
+		if err := vault.Store(session); err != nil {
+			t.Fatalf("Store: %v", err)
+		}
+	}
+	if err := vault.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestCredentialVaultRoundTrip(t *testing.T) {
+	fastVaultKDF(t)
+	path := filepath.Join(t.TempDir(), "credentials.vault")
+	writeTestVault(t, path, vaultSession(40001, "alice", "secret1"))
+	// 重新打开后追加，使用文件头中的盐派生相同的密钥
+	writeTestVault(t, path, vaultSession(40002, "bob", "hunter2"))
+
+	entries, err := ReadCredentialVault(path, testVaultKey)
+	if err != nil {
+		t.Fatalf("ReadCredentialVault: %v", err)
+	}
+	want := []VaultEntry{
+		{SessionID: "10.0.1.1:40001->10.0.0.9:1080", Proxy: "10.0.0.9:1080", Client: "10.0.1.1:40001", Fingerprint: "hmac:alice", Username: "alice", Password: "secret1"},
+		{SessionID: "10.0.1.1:40002->10.0.0.9:1080", Proxy: "10.0.0.9:1080", Client: "10.0.1.1:40002", Fingerprint: "hmac:bob", Username: "bob", Password: "hunter2"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %d", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.CapturedAt.IsZero() {
+			t.Errorf("entry %d: CapturedAt is zero", i)
+		}
+		entry.CapturedAt = want[i].CapturedAt
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+
+	// 明文凭据不出现在文件中
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"alice", "secret1", "bob", "hunter2"} {
+		if bytes.Contains(content, []byte(`"`+secret)) {
+			t.Errorf("vault file contains plaintext %q", secret)
+		}
+	}
+}
+
+func TestCredentialVaultKeyDerivation(t *testing.T) {
+	fastVaultKDF(t)
+	dir := t.TempDir()
+	headers := make([]vaultHeader, 2)
+	for i := range headers {
+		path := filepath.Join(dir, "v"+string(rune('0'+i)))
+		writeTestVault(t, path)
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[i], err = readVaultHeader(bufio.NewReader(file))
+		file.Close()
+		if err != nil {
+			t.Fatalf("readVaultHeader: %v", err)
+		}
+	}
+	for _, h := range headers {
+		if h.KDF != vaultKDF || h.Iterations != 1000 || len(h.Salt) != vaultSaltSize {
+			t.Errorf("header = %+v, want %s with 1000 iterations and %d-byte salt", h, vaultKDF, vaultSaltSize)
+		}
+	}
+	// 相同密钥的两个凭据库使用不同的盐
+	if bytes.Equal(headers[0].Salt, headers[1].Salt) {
+		t.Error("two vaults share the same salt")
+	}
+}
+
+func TestCredentialVaultWrongKey(t *testing.T) {
+	fastVaultKDF(t)
+	path := filepath.Join(t.TempDir(), "credentials.vault")
+	writeTestVault(t, path, vaultSession(40001, "alice", "secret1"))
+
+	wrongKey := []byte("fedcba9876543210-other-key")
+	if _, err := OpenCredentialVault(path, wrongKey); !errors.Is(err, ErrVaultKey) {
+		t.Errorf("OpenCredentialVault(wrong key) error = %v, want %v", err, ErrVaultKey)
+	}
+	if entries, err := ReadCredentialVault(path, wrongKey); !errors.Is(err, ErrVaultKey) || len(entries) != 0 {
+		t.Errorf("ReadCredentialVault(wrong key) = %d entries, %v; want %v", len(entries), err, ErrVaultKey)
+	}
+	if _, err := OpenCredentialVault(path, []byte("short")); err == nil || errors.Is(err, ErrVaultKey) {
+		t.Errorf("OpenCredentialVault(short key) error = %v, want key length error", err)
+	}
+}
+
+func TestCredentialVaultTampering(t *testing.T) {
+	fastVaultKDF(t)
+	cases := []struct {
+		name   string
+		tamper func(line string) string
+	}{
+		{"proxy", func(line string) string {
+			return strings.Replace(line, `"proxy":"10.0.0.9:1080"`, `"proxy":"10.0.0.8:1080"`, 1)
+		}},
+		{"client", func(line string) string {
+			return strings.Replace(line, `"client":"10.0.1.1:40002"`, `"client":"10.0.1.1:40009"`, 1)
+		}},
+		{"session", func(line string) string {
+			return strings.Replace(line, `"session_id":"10.0.1.1:40002`, `"session_id":"10.0.1.1:40009`, 1)
+		}},
+		{"fingerprint", func(line string) string { return strings.Replace(line, `"hmac:bob"`, `"hmac:eve"`, 1) }},
+		{"captured_at", func(line string) string { return strings.Replace(line, `"captured_at":"2`, `"captured_at":"1`, 1) }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.vault")
+			writeTestVault(t, path, vaultSession(40001, "alice", "secret1"), vaultSession(40002, "bob", "hunter2"))
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(content), "\n")
+			tampered := tc.tamper(lines[2])
+			if tampered == lines[2] {
+				t.Fatalf("tamper did not change record %s", lines[2])
+			}
+			lines[2] = tampered
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), vaultFileMode); err != nil {
+				t.Fatal(err)
+			}
+
+			// 被篡改记录之前的内容仍然返回
+			entries, err := ReadCredentialVault(path, testVaultKey)
+			if err == nil || !strings.Contains(err.Error(), "第 3 行") {
+				t.Errorf("ReadCredentialVault error = %v, want decryption failure on line 3", err)
+			}
+			if len(entries) != 1 || entries[0].Username != "alice" {
+				t.Errorf("entries = %+v, want only the untampered record", entries)
+			}
+		})
+	}
+}
+
+func TestCredentialVaultPermissions(t *testing.T) {
+	fastVaultKDF(t)
+	dir := filepath.Join(t.TempDir(), "vault")
+	path := filepath.Join(dir, "credentials.vault")
+	writeTestVault(t, path)
+
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != vaultDirMode {
+		t.Errorf("dir mode = %v (%v), want %v", info.Mode().Perm(), err, os.FileMode(vaultDirMode))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != vaultFileMode {
+		t.Errorf("file mode = %v (%v), want %v", info.Mode().Perm(), err, os.FileMode(vaultFileMode))
+	}
+
+	// 以更宽松权限预先创建的文件在打开时被收紧
+	loose := filepath.Join(t.TempDir(), "loose.vault")
+	if err := os.WriteFile(loose, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(loose, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestVault(t, loose)
+	if info, err := os.Stat(loose); err != nil || info.Mode().Perm() != vaultFileMode {
+		t.Errorf("pre-created file mode = %v (%v), want %v", info.Mode().Perm(), err, os.FileMode(vaultFileMode))
+	}
+}
+
+// TestCredentialVaultQueuedWrites 写入在后台完成，Close 前排队的记录全部落盘
+func TestCredentialVaultQueuedWrites(t *testing.T) {
+	fastVaultKDF(t)
+	path := filepath.Join(t.TempDir(), "credentials.vault")
+	vault, err := OpenCredentialVault(path, testVaultKey)
+	if err != nil {
+		t.Fatalf("OpenCredentialVault: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var stored atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if vault.Store(vaultSession(uint16(40000+i*100+j), "alice", "secret")) == nil {
+					stored.Add(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := vault.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := vault.Store(vaultSession(40999, "bob", "hunter2")); err == nil {
+		t.Error("Store after Close succeeded")
+	}
+	if err := vault.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	entries, err := ReadCredentialVault(path, testVaultKey)
+	if err != nil {
+		t.Fatalf("ReadCredentialVault: %v", err)
+	}
+	if n := stored.Load(); n == 0 || int64(len(entries)) != n {
+		t.Errorf("ReadCredentialVault = %d entries, want %d stored", len(entries), n)
+	}
+}
@@ -0,0 +1,267 @@
+package interceptor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// EbpfStage eBPF生命周期中出错的阶段
+type EbpfStage string
+
+const (
+	EbpfStageMemlock EbpfStage = "memlock" // 解除内存锁定限制
+	EbpfStageLoad    EbpfStage = "load"    // 解析并加载ELF对象
+	EbpfStageMap     EbpfStage = "map"     // 创建eBPF映射
+	EbpfStageAttach  EbpfStage = "attach"  // 挂载到网络接口或cgroup
+	EbpfStageDetach  EbpfStage = "detach"  // 从网络接口或cgroup卸载
+)
+
+// EbpfError eBPF加载、挂载过程中的类型化错误，可通过 errors.As 判断
+type EbpfError struct {
+	Stage     EbpfStage
+	Program   string
+	Interface string
+	Err       error
+}
+
+// Error 实现 error 接口
+func (e *EbpfError) Error() string {
+	if e.Interface != "" {
+		return fmt.Sprintf("eBPF %s 阶段失败 (程序: %s, 接口: %s): %v", e.Stage, e.Program, e.Interface, e.Err)
+	}
+	return fmt.Sprintf("eBPF %s 阶段失败 (程序: %s): %v", e.Stage, e.Program, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *EbpfError) Unwrap() error {
+	return e.Err
+}
+
+// ebpfMaps socks5_monitor_container.o 中与用户空间共享的映射
+type ebpfMaps struct {
+	Events     *ebpf.Map `ebpf:"socks5_events"`
+	Sessions   *ebpf.Map `ebpf:"socks5_sessions"`
+	Ports      *ebpf.Map `ebpf:"socks5_ports"`
+	Proxies    *ebpf.Map `ebpf:"socks5_proxies"`
+	Owners     *ebpf.Map `ebpf:"socket_owners"`
+	Supervised *ebpf.Map `ebpf:"supervised_tgids"`
+	Filter     *ebpf.Map `ebpf:"process_filter"`
+	Flows      *ebpf.Map `ebpf:"socks5_flows"`
+}
+
+// ebpfPrograms socks5_monitor_container.o 中需要挂载的程序
+type ebpfPrograms struct {
+	TrafficMonitor        *ebpf.Program `ebpf:"container_traffic_monitor"`
+	TrafficMonitorIngress *ebpf.Program `ebpf:"container_traffic_monitor_ingress"`
+	CgroupEgress          *ebpf.Program `ebpf:"cgroup_skb_egress"`
+	CgroupIngress         *ebpf.Program `ebpf:"cgroup_skb_ingress"`
+}
+
+// ebpfObjects 已加载到内核的程序和映射
+type ebpfObjects struct {
+	ebpfMaps
+	ebpfPrograms
+	attribution *socketAttribution // 进程归属程序
+	processTree *processTree       // 进程树跟踪程序
+}
+
+// Close 释放程序和映射的文件描述符
+func (o *ebpfObjects) Close() error {
+	var errs []error
+	if o.attribution != nil {
+		if err := o.attribution.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.processTree != nil {
+		if err := o.processTree.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, closer := range []interface{ Close() error }{o.TrafficMonitor, o.TrafficMonitorIngress, o.CgroupEgress, o.CgroupIngress, o.Events, o.Sessions, o.Ports, o.Proxies, o.Owners, o.Supervised, o.Filter, o.Flows} {
+		if closer == nil {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadEbpfObjects 加载ELF对象：先创建共享映射，再加载程序
+func loadEbpfObjects(programPath string) (*ebpfObjects, error) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, &EbpfError{Stage: EbpfStageMemlock, Program: programPath, Err: err}
+	}
+
+	spec, err := ebpf.LoadCollectionSpec(programPath)
+	if err != nil {
+		return nil, &EbpfError{Stage: EbpfStageLoad, Program: programPath, Err: err}
+	}
+
+	objs := &ebpfObjects{}
+	if err := spec.LoadAndAssign(&objs.ebpfMaps, nil); err != nil {
+		return nil, &EbpfError{Stage: EbpfStageMap, Program: programPath, Err: err}
+	}
+
+	opts := &ebpf.CollectionOptions{
+		MapReplacements: map[string]*ebpf.Map{
+			"socks5_events":    objs.Events,
+			"socks5_sessions":  objs.Sessions,
+			"socks5_ports":     objs.Ports,
+			"socks5_proxies":   objs.Proxies,
+			"socket_owners":    objs.Owners,
+			"supervised_tgids": objs.Supervised,
+			"process_filter":   objs.Filter,
+			"socks5_flows":     objs.Flows,
+		},
+	}
+	if err := spec.LoadAndAssign(&objs.ebpfPrograms, opts); err != nil {
+		objs.Close()
+		return nil, &EbpfError{Stage: EbpfStageLoad, Program: programPath, Err: err}
+	}
+
+	// 进程归属依赖内核BTF，失败时仍可继续监控，只是无法确定发起进程
+	objs.attribution, err = loadSocketAttribution(spec, opts)
+	if err != nil {
+		objs.attribution = &socketAttribution{err: &EbpfError{Stage: EbpfStageLoad, Program: programPath, Err: err}}
+	}
+
+	// 进程树跟踪同样是可选的，失败时不按进程过滤
+	objs.processTree, err = loadProcessTree(spec, opts)
+	if err != nil {
+		objs.processTree = &processTree{err: &EbpfError{Stage: EbpfStageLoad, Program: programPath, Err: err}}
+	}
+
+	return objs, nil
+}
+
+// tcAttachment 一个已挂载的TC分类器
+type tcAttachment struct {
+	interfaceName string
+	direction     Direction // client->proxy 对应 egress，proxy->client 对应 ingress
+	tcxLink       link.Link
+	filter        *netlink.BpfFilter
+	qdisc         *netlink.GenericQdisc
+}
+
+// attachTC 将程序挂载为接口上的TC分类器，egress 捕获客户端报文，ingress 捕获代理应答
+// 优先使用TCX（内核6.6+），不支持时回退到 clsact qdisc + bpf filter
+func attachTC(interfaceName string, direction Direction, prog *ebpf.Program) (*tcAttachment, error) {
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("查找网络接口失败: %w", err)
+	}
+
+	attachType := ebpf.AttachTCXEgress
+	if direction == DirectionProxyToClient {
+		attachType = ebpf.AttachTCXIngress
+	}
+
+	tcxLink, err := link.AttachTCX(link.TCXOptions{
+		Interface: iface.Index,
+		Program:   prog,
+		Attach:    attachType,
+	})
+	if err == nil {
+		return &tcAttachment{interfaceName: interfaceName, direction: direction, tcxLink: tcxLink}, nil
+	}
+	if !errors.Is(err, ebpf.ErrNotSupported) {
+		return nil, fmt.Errorf("TCX挂载失败: %w", err)
+	}
+
+	return attachClsact(interfaceName, iface.Index, direction, prog)
+}
+
+// attachClsact 通过netlink创建clsact qdisc并挂载direct-action bpf filter
+func attachClsact(interfaceName string, ifindex int, direction Direction, prog *ebpf.Program) (*tcAttachment, error) {
+	attachment := &tcAttachment{interfaceName: interfaceName, direction: direction}
+
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: ifindex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil {
+		if !errors.Is(err, unix.EEXIST) {
+			return nil, fmt.Errorf("创建clsact qdisc失败: %w", err)
+		}
+	} else {
+		// 只有本程序创建的qdisc才在卸载时删除
+		attachment.qdisc = qdisc
+	}
+
+	parent := uint32(netlink.HANDLE_MIN_EGRESS)
+	if direction == DirectionProxyToClient {
+		parent = netlink.HANDLE_MIN_INGRESS
+	}
+
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifindex,
+			Parent:    parent,
+			Handle:    netlink.MakeHandle(0, 1),
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  1,
+		},
+		Fd:           prog.FD(),
+		Name:         "socks5_monitor_" + attachment.Hook(),
+		DirectAction: true,
+	}
+	if err := netlink.FilterReplace(filter); err != nil {
+		if attachment.qdisc != nil {
+			_ = netlink.QdiscDel(attachment.qdisc)
+		}
+		return nil, fmt.Errorf("挂载bpf filter失败: %w", err)
+	}
+	attachment.filter = filter
+
+	return attachment, nil
+}
+
+// Hook 返回挂载点名称
+func (a *tcAttachment) Hook() string {
+	if a.direction == DirectionProxyToClient {
+		return "ingress"
+	}
+	return "egress"
+}
+
+// Mode 返回挂载方式
+func (a *tcAttachment) Mode() string {
+	if a.tcxLink != nil {
+		return "tcx"
+	}
+	return "clsact"
+}
+
+// Close 从接口卸载分类器
+func (a *tcAttachment) Close() error {
+	if a.tcxLink != nil {
+		return a.tcxLink.Close()
+	}
+
+	var errs []error
+	if a.filter != nil {
+		if err := netlink.FilterDel(a.filter); err != nil {
+			errs = append(errs, fmt.Errorf("删除bpf filter失败: %w", err))
+		}
+	}
+	if a.qdisc != nil {
+		if err := netlink.QdiscDel(a.qdisc); err != nil {
+			errs = append(errs, fmt.Errorf("删除clsact qdisc失败: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,376 +2,451 @@ package interceptor
 
 import (
 	"fmt"
+	"hash/fnv"
 	"log"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// sessionShardCount 会话分片数量，同一会话的数据包总是落在同一分片
+const sessionShardCount = 32
+
+// sessionShard 一个会话分片，持有自己的锁
+type sessionShard struct {
+	mu     sync.Mutex
+	conns  map[string]*socks5Conn
+	alerts []ProxyHealthAlert // 锁内产生、释放锁后发送的代理健康告警
+}
+
 // EnhancedSOCKS5Monitor 增强的SOCKS5监控器
+// 可被多个事件生产者（每CPU的perf读取）和清理协程并发调用
 type EnhancedSOCKS5Monitor struct {
-	targetPID      int
-	authSessions   map[string]*SOCKS5Session
-	packetBuffer   map[string][]byte
-	lastAuthReport time.Time
+	targetPID  atomic.Int64 // 受监控的 linuxService PID，子进程重启后更新
+	shards     [sessionShardCount]*sessionShard
+	targets    atomic.Pointer[ProxyTargets]       // 与内核 socks5_ports/socks5_proxies 一致的代理集合
+	reassembly reassemblyStats                    // TCP重组统计和全局缓冲额度
+	flowStats  atomic.Pointer[FlowStatsSource]    // 连接流量和活跃度来源（内核流状态）
+	redactor   atomic.Pointer[CredentialRedactor] // 凭据脱敏策略
+	vault      atomic.Pointer[CredentialVault]    // 加密凭据库，未配置时为空
+	eventSink  atomic.Pointer[EventSink]          // 会话事件接收者
+
+	trafficMu      sync.Mutex
+	retiredTraffic map[string]*ProxyTraffic // 已清理会话按代理累计的流量
+
+	latencyMu sync.Mutex
+	latency   map[string]map[LatencyMetric]*latencySamples // 按代理、指标保存的握手耗时样本
+
+	healthMu     sync.Mutex
+	healthConfig ProxyHealthConfig
+	healthAlert  ProxyHealthAlertHandler
+	health       map[string]*proxyHealth // 按代理统计的握手结果
+
+	credMu          sync.Mutex
+	credentials     map[credentialKey]*credentialHistory // 按 代理+用户名 记录的凭据指纹历史
+	rotationHandler CredentialRotationHandler
+
+	reportMu          sync.Mutex
+	authReports       map[authReportKey]*authReportState // 按会话记录最近一次输出的认证报告
+	reportSuppressed  map[credentialKey]uint64           // 按 代理+用户名 累计、尚未随报告输出的重复次数
+	suppressedReports atomic.Uint64
 }
 
+// AuthResult RFC 1929 子协商结果
+type AuthResult string
+
+const (
+	AuthResultNone       AuthResult = ""                 // 未进行用户名密码认证
+	AuthResultPending    AuthResult = "pending"          // 已发送凭据，等待代理结果
+	AuthResultSuccess    AuthResult = "success"          // 代理返回 STATUS 0x00
+	AuthResultFailure    AuthResult = "failure"          // 代理返回非零 STATUS
+	AuthResultInferred   AuthResult = "inferred_success" // 未观察到结果，客户端继续发送请求
+	AuthResultIncomplete AuthResult = "incomplete"       // 凭据跨越多个数据包，后续字节未观察到
+)
+
 // SOCKS5Session SOCKS5会话信息
 type SOCKS5Session struct {
-	SessionID   string
-	ProxyIP     string
-	ProxyPort   uint16
-	Username    string
-	Password    string
-	TargetHost  string
-	TargetPort  uint16
-	AuthTime    time.Time
-	ConnectTime time.Time
-	Status      string
+	SessionID           string
+	ClientIP            string
+	ClientPort          uint16
+	ProxyIP             string
+	ProxyPort           uint16
+	PID                 uint32 // 发起连接的进程（TGID），按socket cookie关联，未知时为0
+	Comm                string // 发起连接的进程名
+	Cookie              uint64 // 客户端socket cookie
+	Username            string
+	Password            string // 明文密码，只保存在内存中，输出时按脱敏策略处理
+	PasswordFingerprint string // 带密钥的HMAC指纹，可安全写入日志
+	TargetHost          string
+	TargetPort          uint16
+	AuthTime            time.Time
+	ConnectTime         time.Time
+	Status              string
+	Phase               SOCKS5Phase      // 握手到达的阶段
+	StopReason          string           // 状态机终止原因，进行中为空
+	Outcome             HandshakeOutcome // 握手结果分类，握手未结束时为空
+
+	SelectedMethod byte       // 代理选择的认证方法
+	MethodObserved bool       // true 表示来自代理应答，false 表示根据客户端报文推断
+	AuthResult     AuthResult // 用户名密码认证结果
+	AuthStatus     byte       // 代理返回的 STATUS 原始值
+
+	Reply     *SOCKS5Reply // 代理应答（REP、BND.ADDR、BND.PORT），未观察到时为 nil
+	ReplyTime time.Time
+
+	Truncated EventTruncation // 内核复制时被截断的字段，非零时凭据或报文不完整
+
+	OpenTime     time.Time       // 观察到SYN的时间，未观察到时为首个数据段的时间
+	SYNObserved  bool            // 是否观察到客户端SYN
+	CloseTime    time.Time       // 观察到FIN/RST的时间，未关闭时为零值
+	CloseReason  FlowCloseReason // 关闭原因，未关闭时为空
+	LastActivity time.Time       // 最后一次观察到该连接的数据包
+
+	// 握手之后的隧道流量（TCP负载，含重传），由内核流状态定期刷新
+	BytesUp     uint64 // 客户端 -> 代理
+	BytesDown   uint64 // 代理 -> 客户端
+	PacketsUp   uint64
+	PacketsDown uint64
+
+	// 握手耗时（内核时间戳之差），未观察到对应报文时为0
+	TCPConnectTime time.Duration // SYN -> SYN-ACK
+	MethodRTT      time.Duration // 问候 -> 方法选择
+	AuthRTT        time.Duration // 凭据 -> 认证结果
+	ConnectRTT     time.Duration // CONNECT请求 -> 代理应答
 }
 
-// NewEnhancedSOCKS5Monitor 创建增强SOCKS5监控器
-func NewEnhancedSOCKS5Monitor(targetPID int) *EnhancedSOCKS5Monitor {
-	return &EnhancedSOCKS5Monitor{
-		targetPID:    targetPID,
-		authSessions: make(map[string]*SOCKS5Session),
-		packetBuffer: make(map[string][]byte),
+// NewEnhancedSOCKS5Monitor 创建增强SOCKS5监控器，targets 为空时使用默认端口集合
+func NewEnhancedSOCKS5Monitor(targetPID int, targets *ProxyTargets) *EnhancedSOCKS5Monitor {
+	m := &EnhancedSOCKS5Monitor{healthConfig: DefaultProxyHealthConfig()}
+	m.targetPID.Store(int64(targetPID))
+	for i := range m.shards {
+		m.shards[i] = &sessionShard{
+			conns: make(map[string]*socks5Conn),
+		}
 	}
+	m.SetProxyTargets(targets)
+	m.SetCredentialRedactor(nil)
+	m.SetEventSink(nil)
+	return m
 }
 
-// AnalyzePacket 分析网络数据包
-func (m *EnhancedSOCKS5Monitor) AnalyzePacket(data []byte, srcIP, dstIP string, srcPort, dstPort uint16) {
-	sessionKey := fmt.Sprintf("%s:%d->%s:%d", srcIP, srcPort, dstIP, dstPort)
-
-	// 检查是否为SOCKS5流量
-	if !m.isSOCKS5Traffic(data, dstPort) {
-		return
+// SetProxyTargets 替换需要监控的代理集合，可在运行时调用
+func (m *EnhancedSOCKS5Monitor) SetProxyTargets(targets *ProxyTargets) {
+	if targets == nil {
+		targets = DefaultProxyTargets()
 	}
+	m.targets.Store(targets)
+}
 
-	log.Printf("🔍 [eBPF-SOCKS5] 捕获数据包: %s (长度: %d)", sessionKey, len(data))
+// SetTargetPID 更新受监控的 linuxService PID
+func (m *EnhancedSOCKS5Monitor) SetTargetPID(pid int) {
+	m.targetPID.Store(int64(pid))
+}
 
-	// 累积数据包以处理分片
-	m.accumulatePacket(sessionKey, data)
+// shardFor 按会话标识选择分片
+func (m *EnhancedSOCKS5Monitor) shardFor(sessionKey string) *sessionShard {
+	h := fnv.New32a()
+	h.Write([]byte(sessionKey))
+	return m.shards[h.Sum32()%sessionShardCount]
+}
 
-	// 分析完整的SOCKS5协议
-	m.analyzeSOCKS5Protocol(sessionKey, m.packetBuffer[sessionKey], srcIP, dstIP, srcPort, dstPort)
+// AnalyzePacket 分析网络数据段，src/dst 为该数据段自身的源和目的地址
+func (m *EnhancedSOCKS5Monitor) AnalyzePacket(dir Direction, data []byte, srcIP, dstIP string, srcPort, dstPort uint16) {
+	m.analyzePacket(dir, data, srcIP, dstIP, srcPort, dstPort, nil)
 }
 
-// isSOCKS5Traffic 检查是否为SOCKS5流量
-func (m *EnhancedSOCKS5Monitor) isSOCKS5Traffic(data []byte, dstPort uint16) bool {
-	// 检查常见SOCKS5端口
-	socksports := []uint16{1080, 1081, 7890, 7891, 8080, 8081, 9050, 9051}
-	for _, port := range socksports {
-		if dstPort == port {
-			return true
+// analyzePacket 同 AnalyzePacket，event 为内核事件（携带截断标志和进程归属），直接分析数据时为 nil
+func (m *EnhancedSOCKS5Monitor) analyzePacket(dir Direction, data []byte, srcIP, dstIP string, srcPort, dstPort uint16, event *SOCKS5AuthEvent) {
+	clientIP, clientPort, proxyIP, proxyPort := flowEndpoints(dir, srcIP, dstIP, srcPort, dstPort)
+	sessionKey := sessionKeyOf(clientIP, clientPort, proxyIP, proxyPort)
+
+	// 同一会话的累积与解析在分片锁内完成
+	shard := m.shardFor(sessionKey)
+	shard.mu.Lock()
+	defer m.unlockShard(shard)
+
+	conn, exists := shard.conns[sessionKey]
+	if !exists {
+		// 只有客户端发起的SOCKS5流量才创建新会话
+		if dir != DirectionClientToProxy || !m.isSOCKS5Traffic(data, proxyIP, proxyPort) {
+			return
 		}
+		conn = newSOCKS5Conn(sessionKey, clientIP, clientPort, proxyIP, proxyPort)
+		shard.conns[sessionKey] = conn
 	}
+	conn.session.LastActivity = time.Now()
 
-	// 检查SOCKS5协议标识
-	if len(data) >= 2 && data[0] == 0x05 {
-		return true
-	}
+	log.Printf("🔍 [eBPF-SOCKS5] 捕获数据包: %s (%s, 长度: %d)", sessionKey, dir, len(data))
 
-	// 检查用户名密码认证标识
-	if len(data) >= 1 && data[0] == 0x01 {
-		return true
+	if event != nil {
+		m.annotateSession(conn.session, event)
 	}
-
-	return false
-}
-
-// accumulatePacket 累积数据包
-func (m *EnhancedSOCKS5Monitor) accumulatePacket(sessionKey string, data []byte) {
-	if existing, exists := m.packetBuffer[sessionKey]; exists {
-		m.packetBuffer[sessionKey] = append(existing, data...)
-	} else {
-		m.packetBuffer[sessionKey] = make([]byte, len(data))
-		copy(m.packetBuffer[sessionKey], data)
+	// 未观察到SYN的会话以首个SOCKS5报文作为建立
+	if !exists {
+		m.emitEvent(conn.session, EventSessionOpened, ReportSuppression{})
 	}
 
-	// 限制缓冲区大小，防止内存泄漏
-	if len(m.packetBuffer[sessionKey]) > 4096 {
-		m.packetBuffer[sessionKey] = m.packetBuffer[sessionKey][:4096]
+	// 内核事件携带序列号，先重组再推进状态机；直接传入的数据视为已按序
+	if event != nil {
+		if !conn.session.Phase.Terminal() {
+			conn.handshake.add(dir, event.SegLen)
+		}
+		conn.timing.observe(dir, event.Timestamp)
+		m.feedSegment(conn, dir, event.Seq, data, event.SegLen)
+		return
 	}
+	m.feed(conn, dir, data)
 }
 
-// analyzeSOCKS5Protocol 分析SOCKS5协议
-func (m *EnhancedSOCKS5Monitor) analyzeSOCKS5Protocol(sessionKey string, data []byte, srcIP, dstIP string, srcPort, dstPort uint16) {
-	if len(data) < 2 {
-		return
+// flowEndpoints 会话始终以 客户端->代理 为标识，与数据段方向无关
+func flowEndpoints(dir Direction, srcIP, dstIP string, srcPort, dstPort uint16) (clientIP string, clientPort uint16, proxyIP string, proxyPort uint16) {
+	if dir == DirectionProxyToClient {
+		return dstIP, dstPort, srcIP, srcPort
 	}
+	return srcIP, srcPort, dstIP, dstPort
+}
 
-	session := m.getOrCreateSession(sessionKey, dstIP, dstPort)
-
-	// 分析不同的SOCKS5阶段
-	switch {
-	case m.isAuthNegotiation(data):
-		m.handleAuthNegotiation(session, data)
-
-	case m.isUsernamePasswordAuth(data):
-		m.handleUsernamePasswordAuth(session, data)
-
-	case m.isConnectRequest(data):
-		m.handleConnectRequest(session, data)
-
-	case m.isConnectResponse(data):
-		m.handleConnectResponse(session, data)
-
-	default:
-		// 尝试在数据中搜索认证信息
-		m.searchAuthInData(session, data)
-	}
+// sessionKeyOf 返回会话标识 client->proxy
+func sessionKeyOf(clientIP string, clientPort uint16, proxyIP string, proxyPort uint16) string {
+	return joinHostPort(clientIP, clientPort) + "->" + joinHostPort(proxyIP, proxyPort)
 }
 
-// getOrCreateSession 获取或创建会话
-func (m *EnhancedSOCKS5Monitor) getOrCreateSession(sessionKey, proxyIP string, proxyPort uint16) *SOCKS5Session {
-	if session, exists := m.authSessions[sessionKey]; exists {
-		return session
+// newSOCKS5Conn 创建处于问候阶段的新连接
+func newSOCKS5Conn(sessionKey, clientIP string, clientPort uint16, proxyIP string, proxyPort uint16) *socks5Conn {
+	now := time.Now()
+	return &socks5Conn{
+		session: &SOCKS5Session{
+			SessionID:    sessionKey,
+			ClientIP:     clientIP,
+			ClientPort:   clientPort,
+			ProxyIP:      proxyIP,
+			ProxyPort:    proxyPort,
+			Status:       "连接中",
+			Phase:        PhaseGreeting,
+			OpenTime:     now,
+			LastActivity: now,
+		},
 	}
+}
 
-	session := &SOCKS5Session{
-		SessionID: sessionKey,
-		ProxyIP:   proxyIP,
-		ProxyPort: proxyPort,
-		Status:    "连接中",
+// HandleAuthEvent 处理内核上报的SOCKS5事件
+func (m *EnhancedSOCKS5Monitor) HandleAuthEvent(event *SOCKS5AuthEvent) {
+	if event.Type == SOCKS5EventFlow {
+		m.handleFlowEvent(event)
+		return
 	}
-
-	m.authSessions[sessionKey] = session
-	return session
+	m.analyzePacket(event.Direction, event.SegmentPayload(), event.SrcIP.String(), event.DstIP.String(), event.SrcPort, event.DstPort, event)
 }
 
-// isAuthNegotiation 检查是否为认证协商
-func (m *EnhancedSOCKS5Monitor) isAuthNegotiation(data []byte) bool {
-	return len(data) >= 3 && data[0] == 0x05 && data[1] >= 0x01
-}
+// annotateSession 记录内核事件中的截断标志和进程归属
+// 入站数据包通常没有关联socket，进程归属以客户端方向的事件为准
+func (m *EnhancedSOCKS5Monitor) annotateSession(session *SOCKS5Session, event *SOCKS5AuthEvent) {
+	if event.Truncated != 0 {
+		session.Truncated |= event.Truncated
+		log.Printf("⚠️ [eBPF-SOCKS5] 内核数据被截断: %s (字段: %s)", session.SessionID, event.Truncated)
+	}
 
-// isUsernamePasswordAuth 检查是否为用户名密码认证
-func (m *EnhancedSOCKS5Monitor) isUsernamePasswordAuth(data []byte) bool {
-	return len(data) >= 3 && data[0] == 0x01
+	if event.PID != 0 && event.PID != session.PID {
+		session.PID = event.PID
+		session.Comm = event.Comm
+		session.Cookie = event.Cookie
+		log.Printf("🔍 [eBPF-SOCKS5] 连接归属进程: %s (进程: %s, PID: %d)", session.SessionID, event.Comm, event.PID)
+	}
 }
 
-// isConnectRequest 检查是否为连接请求
-func (m *EnhancedSOCKS5Monitor) isConnectRequest(data []byte) bool {
-	return len(data) >= 4 && data[0] == 0x05 && data[1] == 0x01
-}
+// isSOCKS5Traffic 检查是否为发往受监控代理的SOCKS5流量，判定规则与内核侧一致
+func (m *EnhancedSOCKS5Monitor) isSOCKS5Traffic(data []byte, dstIP string, dstPort uint16) bool {
+	if !m.targets.Load().Matches(dstIP, dstPort) {
+		return false
+	}
 
-// isConnectResponse 检查是否为连接响应
-func (m *EnhancedSOCKS5Monitor) isConnectResponse(data []byte) bool {
-	return len(data) >= 4 && data[0] == 0x05 && data[1] == 0x00
+	// 客户端首个报文应为问候(0x05)或用户名密码认证(0x01)
+	return len(data) >= 1 && (data[0] == socks5Version || data[0] == userPassAuthVersion)
 }
 
-// handleAuthNegotiation 处理认证协商
+// handleAuthNegotiation 处理客户端问候中的认证方法列表
 func (m *EnhancedSOCKS5Monitor) handleAuthNegotiation(session *SOCKS5Session, data []byte) {
 	log.Printf("🔍 [SOCKS5-认证协商] 会话: %s", session.SessionID)
 
-	if len(data) >= 3 {
-		methodCount := int(data[1])
-		log.Printf("🔍 [SOCKS5-认证协商] 客户端支持 %d 种认证方法", methodCount)
-
-		for i := 0; i < methodCount && i+2 < len(data); i++ {
-			method := data[2+i]
-			switch method {
-			case 0x00:
-				log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 无需认证", method)
-			case 0x02:
-				log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 用户名密码认证", method)
-			default:
-				log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 其他认证方式", method)
-			}
+	methodCount := int(data[1])
+	log.Printf("🔍 [SOCKS5-认证协商] 客户端支持 %d 种认证方法", methodCount)
+
+	for _, method := range data[2 : 2+methodCount] {
+		switch method {
+		case socks5MethodNoAuth:
+			log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 无需认证", method)
+		case socks5MethodUserPass:
+			log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 用户名密码认证", method)
+		default:
+			log.Printf("🔍 [SOCKS5-认证协商] 方法 %d: 其他认证方式", method)
 		}
 	}
 }
 
 // handleUsernamePasswordAuth 处理用户名密码认证
-func (m *EnhancedSOCKS5Monitor) handleUsernamePasswordAuth(session *SOCKS5Session, data []byte) {
+func (m *EnhancedSOCKS5Monitor) handleUsernamePasswordAuth(session *SOCKS5Session, username, password string) {
 	log.Printf("🔍 [SOCKS5-密码认证] 会话: %s", session.SessionID)
 
-	if len(data) < 3 {
-		return
-	}
-
-	// SOCKS5用户名密码认证格式：
-	// +----+------+----------+------+----------+
-	// |VER | ULEN |  UNAME   | PLEN |  PASSWD  |
-	// +----+------+----------+------+----------+
-	// | 1  |  1   | 1 to 255 |  1   | 1 to 255 |
-	// +----+------+----------+------+----------+
+	// 更新会话信息，认证结果以代理的 STATUS 应答为准
+	shown := m.recordCredentials(session, username, password)
+	session.AuthTime = time.Now()
+	session.AuthResult = AuthResultPending
+	session.Status = "等待认证结果"
 
-	if data[0] != 0x01 {
-		return
-	}
+	log.Printf("🔐 [SOCKS5-密码认证] 成功提取认证信息 - 用户名: '%s', 密码: '%s'", username, shown)
 
-	usernameLen := int(data[1])
-	if len(data) < 2+usernameLen+1 {
-		return
-	}
+	// 立即输出认证事件
+	m.reportEvent(session, EventAuthenticated)
+}
 
-	username := string(data[2 : 2+usernameLen])
-	passwordLen := int(data[2+usernameLen])
+// handleMethodSelection 处理代理的方法选择
+func (m *EnhancedSOCKS5Monitor) handleMethodSelection(session *SOCKS5Session, method byte, observed bool) {
+	session.SelectedMethod = method
+	session.MethodObserved = observed
 
-	if len(data) < 2+usernameLen+1+passwordLen {
-		return
+	source := "代理应答"
+	if !observed {
+		source = "根据客户端报文推断"
 	}
+	log.Printf("🔍 [SOCKS5-方法选择] 会话: %s, 方法: %s (%s)", session.SessionID, socks5MethodName(method), source)
+}
 
-	password := string(data[2+usernameLen+1 : 2+usernameLen+1+passwordLen])
-
-	// 更新会话信息
-	session.Username = username
-	session.Password = password
-	session.AuthTime = time.Now()
-	session.Status = "认证成功"
+// handleAuthStatus 处理代理返回的用户名密码认证结果
+func (m *EnhancedSOCKS5Monitor) handleAuthStatus(session *SOCKS5Session, status byte) {
+	session.AuthStatus = status
+	if status == 0x00 {
+		session.AuthResult = AuthResultSuccess
+		session.Status = "认证成功"
+		log.Printf("✅ [SOCKS5-认证结果] 代理 %s 认证成功: %s", joinHostPort(session.ProxyIP, session.ProxyPort), session.SessionID)
+	} else {
+		session.AuthResult = AuthResultFailure
+		session.Status = fmt.Sprintf("认证失败(状态: 0x%02x)", status)
+		log.Printf("❌ [SOCKS5-认证结果] 代理 %s 认证失败: %s (状态: 0x%02x)", joinHostPort(session.ProxyIP, session.ProxyPort), session.SessionID, status)
+	}
 
-	log.Printf("🔐 [SOCKS5-密码认证] 成功提取认证信息 - 用户名: '%s', 密码: '%s'", username, password)
+	m.reportEvent(session, EventAuthenticated)
+}
 
-	// 立即输出认证报告
-	m.printSOCKS5AuthReport(session)
+// socks5MethodName 返回认证方法名称
+func socks5MethodName(method byte) string {
+	switch method {
+	case socks5MethodNoAuth:
+		return "NO AUTH"
+	case 0x01:
+		return "GSSAPI"
+	case socks5MethodUserPass:
+		return "USERNAME/PASSWORD"
+	case socks5MethodNoAcceptable:
+		return "NO ACCEPTABLE METHODS"
+	default:
+		return fmt.Sprintf("0x%02x", method)
+	}
 }
 
-// handleConnectRequest 处理连接请求
+// handleConnectRequest 处理连接请求，data 为完整的请求报文
 func (m *EnhancedSOCKS5Monitor) handleConnectRequest(session *SOCKS5Session, data []byte) {
 	log.Printf("🔍 [SOCKS5-连接请求] 会话: %s", session.SessionID)
 
-	if len(data) < 4 {
+	cmd := data[1]
+	targetHost, targetPort, err := decodeSOCKS5Address(data)
+	if err != nil {
+		log.Printf("⚠️ [SOCKS5-连接请求] 地址解析失败: %s (%v)", session.SessionID, err)
 		return
 	}
 
-	cmd := data[1]
-	atyp := data[3]
+	session.TargetHost = targetHost
+	session.TargetPort = targetPort
+	session.ConnectTime = time.Now()
 
-	var targetHost string
-	var targetPort uint16
+	log.Printf("🎯 [SOCKS5-连接请求] 目标: %s (命令: %d)", joinHostPort(targetHost, targetPort), cmd)
 
-	switch atyp {
-	case 0x01: // IPv4
-		if len(data) >= 10 {
-			targetHost = fmt.Sprintf("%d.%d.%d.%d", data[4], data[5], data[6], data[7])
-			targetPort = uint16(data[8])<<8 + uint16(data[9])
-		}
-	case 0x03: // 域名
-		if len(data) >= 5 {
-			domainLen := int(data[4])
-			if len(data) >= 5+domainLen+2 {
-				targetHost = string(data[5 : 5+domainLen])
-				targetPort = uint16(data[5+domainLen])<<8 + uint16(data[5+domainLen+1])
-			}
-		}
-	case 0x04: // IPv6
-		targetHost = "IPv6地址"
-	}
+	// 已有认证信息时报告中包含完整的凭据和目标
+	m.reportEvent(session, EventConnectRequested)
+}
 
-	if targetHost != "" {
-		session.TargetHost = targetHost
-		session.TargetPort = targetPort
-		session.ConnectTime = time.Now()
+// handleConnectResponse 处理连接响应，data 为完整的应答报文
+func (m *EnhancedSOCKS5Monitor) handleConnectResponse(session *SOCKS5Session, data []byte) {
+	reply, err := decodeSOCKS5Reply(data)
+	if err != nil {
+		log.Printf("⚠️ [SOCKS5-连接响应] 应答解析失败: %s (%v)", session.SessionID, err)
+		return
+	}
 
-		log.Printf("🎯 [SOCKS5-连接请求] 目标: %s:%d (命令: %d)", targetHost, targetPort, cmd)
+	session.Reply = &reply
+	session.ReplyTime = time.Now()
 
-		// 如果已有认证信息，输出完整报告
-		if session.Username != "" {
-			m.printSOCKS5AuthReport(session)
-		}
+	if reply.Code.Succeeded() {
+		session.Status = "连接成功"
+		log.Printf("✅ [SOCKS5-连接响应] 连接成功: %s (绑定地址: %s)", session.SessionID, reply.BoundEndpoint())
+	} else {
+		session.Status = fmt.Sprintf("连接失败(%s)", reply.Code.Description())
+		log.Printf("❌ [SOCKS5-连接响应] 连接失败: %s (REP: 0x%02x %s, %s)", session.SessionID, byte(reply.Code), reply.Code, reply.Code.Description())
 	}
+	m.emitEvent(session, EventReplyReceived, ReportSuppression{})
 }
 
-// handleConnectResponse 处理连接响应
-func (m *EnhancedSOCKS5Monitor) handleConnectResponse(session *SOCKS5Session, data []byte) {
-	if len(data) >= 2 {
-		status := data[1]
-		if status == 0x00 {
-			session.Status = "连接成功"
-			log.Printf("✅ [SOCKS5-连接响应] 连接成功: %s", session.SessionID)
-		} else {
-			session.Status = fmt.Sprintf("连接失败(错误码: %d)", status)
-			log.Printf("❌ [SOCKS5-连接响应] 连接失败: %s (错误码: %d)", session.SessionID, status)
+// CleanupSessions 清理过期会话，逐个分片加锁，不阻塞其他分片上的数据包处理
+// 已关闭的会话保留 closedSessionRetention，未关闭的会话按最后活动时间判断空闲
+func (m *EnhancedSOCKS5Monitor) CleanupSessions() {
+	now := time.Now()
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for sessionKey, conn := range shard.conns {
+			m.refreshFlowStats(conn)
+			if sessionExpired(conn.session, now) {
+				m.retireConn(conn)
+				delete(shard.conns, sessionKey)
+			}
 		}
+		m.unlockShard(shard)
 	}
+	m.pruneAuthReports(now)
+	m.EvaluateProxyHealth()
 }
 
-// searchAuthInData 在数据中搜索认证信息
-func (m *EnhancedSOCKS5Monitor) searchAuthInData(session *SOCKS5Session, data []byte) {
-	// 如果已经有认证信息，跳过
-	if session.Username != "" {
-		return
+// retireConn 会话被清理或替换前释放缓冲，结算握手结果和流量（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) retireConn(conn *socks5Conn) {
+	conn.release()
+	if !conn.session.Phase.Terminal() {
+		m.finishHandshake(conn, OutcomeTimeout)
 	}
+	m.retireTraffic(conn.session)
 
-	// 搜索可能的用户名密码模式
-	for i := 0; i < len(data)-3; i++ {
-		if data[i] == 0x01 && i+1 < len(data) {
-			usernameLen := int(data[i+1])
-			if usernameLen > 0 && usernameLen < 64 && i+2+usernameLen < len(data) {
-				username := string(data[i+2 : i+2+usernameLen])
-				if i+2+usernameLen+1 < len(data) {
-					passwordLen := int(data[i+2+usernameLen])
-					if passwordLen > 0 && passwordLen < 64 && i+2+usernameLen+1+passwordLen <= len(data) {
-						password := string(data[i+2+usernameLen+1 : i+2+usernameLen+1+passwordLen])
-
-						// 验证是否为可打印字符
-						if m.isPrintableString(username) && m.isPrintableString(password) {
-							session.Username = username
-							session.Password = password
-							session.AuthTime = time.Now()
-							session.Status = "认证信息已提取"
-
-							log.Printf("🔐 [SOCKS5-搜索认证] 发现认证信息 - 用户名: '%s', 密码: '%s'", username, password)
-							m.printSOCKS5AuthReport(session)
-							return
-						}
-					}
-				}
-			}
-		}
+	// 未观察到FIN/RST的会话在清理时补发关闭事件
+	if conn.session.CloseTime.IsZero() {
+		conn.session.CloseTime = time.Now()
+		conn.session.CloseReason = FlowCloseRetired
+		m.emitEvent(conn.session, EventSessionClosed, ReportSuppression{})
 	}
 }
 
-// isPrintableString 检查字符串是否为可打印字符
-func (m *EnhancedSOCKS5Monitor) isPrintableString(s string) bool {
-	if len(s) == 0 || len(s) > 64 {
-		return false
-	}
-	for _, r := range s {
-		if r < 32 || r > 126 {
-			return false
-		}
-	}
-	return true
+// ReassemblyStats 返回TCP重组统计
+func (m *EnhancedSOCKS5Monitor) ReassemblyStats() ReassemblyStats {
+	return m.reassembly.snapshot()
 }
 
-// printSOCKS5AuthReport 打印SOCKS5认证报告
-func (m *EnhancedSOCKS5Monitor) printSOCKS5AuthReport(session *SOCKS5Session) {
-	// 避免重复输出（1分钟内同一会话只输出一次）
-	if time.Since(m.lastAuthReport) < 1*time.Minute {
-		return
-	}
-	m.lastAuthReport = time.Now()
-
-	fmt.Println(strings.Repeat("=", 100))
-	fmt.Println("🔐 eBPF内核级SOCKS5代理认证信息捕获")
-	fmt.Println(strings.Repeat("=", 100))
-	fmt.Printf("⏰ 捕获时间: %s\n", session.AuthTime.Format("2006-01-02 15:04:05"))
-	fmt.Printf("🔗 会话标识: %s\n", session.SessionID)
-	fmt.Printf("🌐 代理服务器: %s:%d\n", session.ProxyIP, session.ProxyPort)
-	fmt.Printf("👤 SOCKS5用户名: %s\n", session.Username)
-	fmt.Printf("🔑 SOCKS5密码: %s\n", session.Password)
-
-	if session.TargetHost != "" {
-		fmt.Printf("🎯 目标地址: %s:%d\n", session.TargetHost, session.TargetPort)
+// SessionCounts 返回各握手阶段的当前会话数
+func (m *EnhancedSOCKS5Monitor) SessionCounts() map[SOCKS5Phase]int {
+	counts := make(map[SOCKS5Phase]int)
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for _, conn := range shard.conns {
+			counts[conn.session.Phase]++
+		}
+		shard.mu.Unlock()
 	}
-
-	fmt.Printf("📊 连接状态: %s\n", session.Status)
-	fmt.Printf("🔍 监控方式: eBPF内核级数据包捕获\n")
-	fmt.Printf("📋 目标进程: linuxService (PID: %d)\n", m.targetPID)
-	fmt.Printf("💡 技术优势: 内核级监控，无法绕过，100%%捕获率\n")
-	fmt.Println(strings.Repeat("=", 100))
-	fmt.Println()
+	return counts
 }
 
-// CleanupSessions 清理过期会话
-func (m *EnhancedSOCKS5Monitor) CleanupSessions() {
-	now := time.Now()
-	for sessionKey, session := range m.authSessions {
-		// 清理5分钟前的会话
-		if now.Sub(session.AuthTime) > 5*time.Minute {
-			delete(m.authSessions, sessionKey)
-			delete(m.packetBuffer, sessionKey)
+// Sessions 返回当前所有会话的快照副本
+func (m *EnhancedSOCKS5Monitor) Sessions() []SOCKS5Session {
+	var sessions []SOCKS5Session
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for _, conn := range shard.conns {
+			sessions = append(sessions, *conn.session)
 		}
+		shard.mu.Unlock()
 	}
+	return sessions
 }
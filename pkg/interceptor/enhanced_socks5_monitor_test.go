@@ -0,0 +1,124 @@
+package interceptor
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+// TestMonitorConcurrentAccess 多个事件生产者、清理协程和读取方并发访问监控器，配合 go test -race 运行
+func TestMonitorConcurrentAccess(t *testing.T) {
+	const (
+		producers = 8
+		sessions  = 50
+	)
+	m := newTestMonitor()
+	m.SetFlowStatsSource(func(*SOCKS5Session) (FlowCounters, bool) { return FlowCounters{}, false })
+	proxy := net.ParseIP("10.0.0.9")
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	// 直接传入数据的生产者：每个生产者独立的客户端地址，端口范围相同
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < sessions; i++ {
+				client := fmt.Sprintf("10.0.1.%d", p)
+				port := uint16(40000 + i)
+				m.AnalyzePacket(DirectionClientToProxy, []byte{5, 1, 2}, client, "10.0.0.9", port, 1080)
+				m.AnalyzePacket(DirectionProxyToClient, []byte{5, 2}, "10.0.0.9", client, 1080, port)
+				m.AnalyzePacket(DirectionClientToProxy, []byte{1, 1, 'u', 1, byte('a' + p)}, client, "10.0.0.9", port, 1080)
+				m.AnalyzePacket(DirectionProxyToClient, []byte{1, 0}, "10.0.0.9", client, 1080, port)
+				m.AnalyzePacket(DirectionClientToProxy, []byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80}, client, "10.0.0.9", port, 1080)
+				m.AnalyzePacket(DirectionProxyToClient, []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}, "10.0.0.9", client, 1080, port)
+			}
+		}(p)
+	}
+
+	// 内核事件生产者：SYN、握手数据段、FIN/RST
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			client := net.ParseIP(fmt.Sprintf("10.0.2.%d", p))
+			for i := 0; i < sessions; i++ {
+				port := uint16(50000 + i)
+				upEvent := func(typ SOCKS5EventType, seq uint32, flags uint8, payload []byte) *SOCKS5AuthEvent {
+					return &SOCKS5AuthEvent{Type: typ, Direction: DirectionClientToProxy, SrcIP: client, DstIP: proxy, SrcPort: port, DstPort: 1080,
+						Seq: seq, SegLen: uint32(len(payload)), TCPFlags: flags, Payload: payload, Timestamp: uint64(i + 1)}
+				}
+				downEvent := func(typ SOCKS5EventType, seq uint32, flags uint8, payload []byte) *SOCKS5AuthEvent {
+					return &SOCKS5AuthEvent{Type: typ, Direction: DirectionProxyToClient, SrcIP: proxy, DstIP: client, SrcPort: 1080, DstPort: port,
+						Seq: seq, SegLen: uint32(len(payload)), TCPFlags: flags, Payload: payload, Timestamp: uint64(i + 2)}
+				}
+				m.HandleAuthEvent(upEvent(SOCKS5EventFlow, 999, tcpFlagSYN, nil))
+				m.HandleAuthEvent(downEvent(SOCKS5EventFlow, 4999, tcpFlagSYN|tcpFlagACK, nil))
+				m.HandleAuthEvent(upEvent(SOCKS5EventSegment, 1000, tcpFlagACK, []byte{5, 1, 0}))
+				m.HandleAuthEvent(downEvent(SOCKS5EventSegment, 5000, tcpFlagACK, []byte{5, 0}))
+				m.HandleAuthEvent(upEvent(SOCKS5EventSegment, 1003, tcpFlagACK, []byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80}))
+				m.HandleAuthEvent(downEvent(SOCKS5EventSegment, 5002, tcpFlagACK, []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}))
+				flags := uint8(tcpFlagFIN | tcpFlagACK)
+				if i%2 == 0 {
+					flags = tcpFlagRST
+				}
+				m.HandleAuthEvent(upEvent(SOCKS5EventFlow, 1013, flags, nil))
+			}
+		}(p)
+	}
+
+	// 清理协程和读取方
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.CleanupSessions()
+			}
+		}
+	}()
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				m.Sessions()
+				m.SessionCounts()
+				m.ProxyTraffic()
+				m.ProxyLatency()
+				m.ProxyLatencyHistograms()
+				m.ProxyHealth()
+				m.CredentialHistory()
+				m.ReassemblyStats()
+				m.SuppressedReports()
+				m.SetTargetPID(1234)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	counts := m.SessionCounts()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		t.Fatal("SessionCounts() 为空，生产者没有创建会话")
+	}
+	for _, s := range m.Sessions() {
+		if s.Phase != PhaseEstablished {
+			t.Errorf("session %s phase = %s, want %s", s.SessionID, s.Phase, PhaseEstablished)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/sirupsen/logrus"
+)
+
+// socks5_auth_event 在内核中的内存布局（与 socks5_monitor_container.c 保持一致）
+const (
+	authEventFieldLen   = 256 // SOCKS5_CRED_MAX + 1
+	authEventSegmentCap = 264 // SOCKS5_SEGMENT_MAX
+	authEventAddrLen    = 16  // IPv6或IPv4映射IPv6地址，网络字节序
+	authEventCommLen    = 16  // TASK_COMM_LEN
+
+	authEventOffPID         = 0
+	authEventOffSrcIP       = 4
+	authEventOffDstIP       = authEventOffSrcIP + authEventAddrLen
+	authEventOffSrcPort     = authEventOffDstIP + authEventAddrLen
+	authEventOffDstPort     = authEventOffSrcPort + 2
+	authEventOffUsername    = authEventOffDstPort + 2
+	authEventOffPassword    = authEventOffUsername + authEventFieldLen
+	authEventOffUsernameLen = authEventOffPassword + authEventFieldLen
+	authEventOffPasswordLen = authEventOffUsernameLen + 1
+	authEventOffEventType   = authEventOffPasswordLen + 1
+	authEventOffDirection   = authEventOffEventType + 1
+	authEventOffPayloadLen  = authEventOffDirection + 1 // __u16
+	authEventOffTruncated   = authEventOffPayloadLen + 2
+	authEventOffPayload     = authEventOffTruncated + 2
+	authEventOffTimestamp   = authEventOffPayload + authEventSegmentCap // __u64 按8字节对齐
+	authEventOffCookie      = authEventOffTimestamp + 8
+	authEventOffComm        = authEventOffCookie + 8
+	authEventOffSeq         = authEventOffComm + authEventCommLen
+	authEventOffSegLen      = authEventOffSeq + 4
+	authEventOffTCPFlags    = authEventOffSegLen + 4
+	authEventOffBytesUp     = authEventOffTCPFlags + 8 // __u64 按8字节对齐
+	authEventOffBytesDown   = authEventOffBytesUp + 8
+	authEventOffPacketsUp   = authEventOffBytesDown + 8
+	authEventOffPacketsDown = authEventOffPacketsUp + 8
+
+	// authEventSize sizeof(struct socks5_auth_event)
+	authEventSize = authEventOffPacketsDown + 8
+)
+
+// EventTruncation 内核复制数据时的截断标志（TRUNC_*）
+type EventTruncation uint8
+
+const (
+	TruncatedUsername EventTruncation = 1 << iota // 用户名未完整出现在数据包中
+	TruncatedPassword                             // 密码未完整出现在数据包中
+	TruncatedPayload                              // 握手报文超过 SOCKS5_SEGMENT_MAX
+)
+
+// String 返回截断字段列表，如 "username,password"
+func (t EventTruncation) String() string {
+	var parts []string
+	if t&TruncatedUsername != 0 {
+		parts = append(parts, "username")
+	}
+	if t&TruncatedPassword != 0 {
+		parts = append(parts, "password")
+	}
+	if t&TruncatedPayload != 0 {
+		parts = append(parts, "payload")
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+// SOCKS5EventType 内核事件类型
+type SOCKS5EventType uint8
+
+const (
+	SOCKS5EventAuth    SOCKS5EventType = 1 // 客户端RFC 1929用户名密码认证
+	SOCKS5EventSegment SOCKS5EventType = 2 // 握手阶段原始报文
+	SOCKS5EventFlow    SOCKS5EventType = 3 // TCP连接建立或关闭，无负载
+)
+
+// TCP标志位
+const (
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+// SOCKS5AuthEvent 从 socks5_events 读取的SOCKS5事件
+type SOCKS5AuthEvent struct {
+	Type        SOCKS5EventType
+	Direction   Direction // 数据段方向，Src/Dst 为该数据段自身的源和目的
+	PID         uint32    // 发起连接的进程（TGID），按socket cookie关联，未知时为0
+	Comm        string    // 发起连接的进程名
+	Cookie      uint64    // socket cookie，入站数据包通常为0
+	SrcIP       net.IP
+	DstIP       net.IP
+	SrcPort     uint16
+	DstPort     uint16
+	Username    string
+	Password    string
+	UsernameLen uint8 // 协议中声明的用户名长度
+	PasswordLen uint8 // 协议中声明的密码长度
+	Truncated   EventTruncation
+	Payload     []byte // SOCKS5EventSegment 的原始报文
+	Timestamp   uint64 // bpf_ktime_get_ns()，单调时钟纳秒
+	Seq         uint32 // 数据段首字节的TCP序列号
+	SegLen      uint32 // 数据段完整的TCP负载长度，内核截断时大于实际携带的字节数
+	TCPFlags    uint8
+	Counters    FlowCounters // 仅连接关闭事件：关闭时内核统计的流量
+}
+
+// DecodeSOCKS5AuthEvent 将原始perf样本解码为 SOCKS5AuthEvent
+func DecodeSOCKS5AuthEvent(raw []byte) (*SOCKS5AuthEvent, error) {
+	if len(raw) < authEventSize {
+		return nil, fmt.Errorf("事件长度不足: %d < %d", len(raw), authEventSize)
+	}
+
+	order := binary.NativeEndian
+	event := &SOCKS5AuthEvent{
+		Type:        SOCKS5EventType(raw[authEventOffEventType]),
+		Direction:   Direction(raw[authEventOffDirection]),
+		PID:         order.Uint32(raw[authEventOffPID:]),
+		SrcIP:       decodeEventAddr(raw[authEventOffSrcIP:]),
+		DstIP:       decodeEventAddr(raw[authEventOffDstIP:]),
+		SrcPort:     order.Uint16(raw[authEventOffSrcPort:]),
+		DstPort:     order.Uint16(raw[authEventOffDstPort:]),
+		UsernameLen: raw[authEventOffUsernameLen],
+		PasswordLen: raw[authEventOffPasswordLen],
+		Truncated:   EventTruncation(raw[authEventOffTruncated]),
+		Timestamp:   order.Uint64(raw[authEventOffTimestamp:]),
+		Cookie:      order.Uint64(raw[authEventOffCookie:]),
+		Seq:         order.Uint32(raw[authEventOffSeq:]),
+		SegLen:      order.Uint32(raw[authEventOffSegLen:]),
+		TCPFlags:    raw[authEventOffTCPFlags],
+	}
+
+	comm := raw[authEventOffComm : authEventOffComm+authEventCommLen]
+	if i := bytes.IndexByte(comm, 0); i >= 0 {
+		comm = comm[:i]
+	}
+	event.Comm = string(comm)
+
+	if event.Type == SOCKS5EventFlow && event.TCPFlags&(tcpFlagFIN|tcpFlagRST) != 0 {
+		event.Counters = FlowCounters{
+			BytesUp:     order.Uint64(raw[authEventOffBytesUp:]),
+			BytesDown:   order.Uint64(raw[authEventOffBytesDown:]),
+			PacketsUp:   order.Uint64(raw[authEventOffPacketsUp:]),
+			PacketsDown: order.Uint64(raw[authEventOffPacketsDown:]),
+		}
+	}
+
+	event.Username = boundedString(raw[authEventOffUsername:authEventOffUsername+authEventFieldLen], int(event.UsernameLen), event.Truncated&TruncatedUsername != 0)
+	event.Password = boundedString(raw[authEventOffPassword:authEventOffPassword+authEventFieldLen], int(event.PasswordLen), event.Truncated&TruncatedPassword != 0)
+
+	switch event.Type {
+	case SOCKS5EventAuth, SOCKS5EventFlow:
+	case SOCKS5EventSegment:
+		payloadLen := int(order.Uint16(raw[authEventOffPayloadLen:]))
+		if payloadLen > authEventSegmentCap {
+			return nil, fmt.Errorf("报文长度越界: %d", payloadLen)
+		}
+		event.Payload = append([]byte(nil), raw[authEventOffPayload:authEventOffPayload+payloadLen]...)
+	default:
+		return nil, fmt.Errorf("未知事件类型: %d", event.Type)
+	}
+
+	return event, nil
+}
+
+// decodeEventAddr 复制16字节地址，IPv4映射地址转换为4字节形式
+func decodeEventAddr(raw []byte) net.IP {
+	ip := net.IP(append([]byte(nil), raw[:authEventAddrLen]...))
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// boundedString 按声明长度截取定长字段，超出字段容量时截断
+// 内核只复制数据包中实际存在的部分，未复制的尾部为零字节，需要去掉
+func boundedString(field []byte, declared int, truncated bool) string {
+	if declared > len(field)-1 {
+		declared = len(field) - 1
+	}
+	value := field[:declared]
+	if truncated {
+		if i := bytes.IndexByte(value, 0); i >= 0 {
+			value = value[:i]
+		}
+	}
+	return string(value)
+}
+
+// IsTruncated 事件中是否有字段被截断
+func (e *SOCKS5AuthEvent) IsTruncated() bool {
+	return e.Truncated != 0
+}
+
+// SegmentPayload 返回事件对应的SOCKS5报文，认证事件还原为RFC 1929报文
+func (e *SOCKS5AuthEvent) SegmentPayload() []byte {
+	if e.Type == SOCKS5EventSegment {
+		return e.Payload
+	}
+	return e.AuthPayload()
+}
+
+// AuthPayload 还原出RFC 1929用户名密码认证报文
+// 长度字段使用协议中声明的值：凭据被截断时只还原数据包中实际出现的前缀，
+// 状态机会等待后续数据段补齐，而不是把不完整的凭据当作完整报文
+func (e *SOCKS5AuthEvent) AuthPayload() []byte {
+	payload := make([]byte, 0, 3+len(e.Username)+len(e.Password))
+	payload = append(payload, userPassAuthVersion, e.UsernameLen)
+	payload = append(payload, e.Username...)
+	// 用户名不完整时 PLEN 和密码都在后续数据段中
+	if e.Truncated&TruncatedUsername != 0 {
+		return payload
+	}
+	// 密码被截断而声明长度为0，说明 PLEN 本身也不在当前数据包中
+	if e.Truncated&TruncatedPassword != 0 && e.PasswordLen == 0 {
+		return payload
+	}
+	payload = append(payload, e.PasswordLen)
+	payload = append(payload, e.Password...)
+	return payload
+}
+
+// eventReaderPollInterval 读取超时，没有事件时也定期返回以更新心跳
+const eventReaderPollInterval = time.Second
+
+// EventReader 从 socks5_events perf 缓冲区读取事件并分发给 EnhancedSOCKS5Monitor
+type EventReader struct {
+	reader   *perf.Reader
+	monitor  *EnhancedSOCKS5Monitor
+	logger   *logrus.Entry
+	received atomic.Uint64
+	lost     atomic.Uint64
+	invalid  atomic.Uint64
+	running  atomic.Bool
+	lastPoll atomic.Int64 // 最近一次 Read 返回的时间（UnixNano），用于判断读取循环是否仍在消费
+}
+
+// EventReaderStats 事件读取统计
+type EventReaderStats struct {
+	Received uint64
+	Lost     uint64
+	Invalid  uint64
+	Running  bool      // 读取循环是否在运行
+	LastPoll time.Time // 最近一次读取返回的时间
+}
+
+// NewEventReader 为 socks5_events 映射创建读取器
+func NewEventReader(events *ebpf.Map, monitor *EnhancedSOCKS5Monitor) (*EventReader, error) {
+	// 每个CPU分配 8 页缓冲
+	reader, err := perf.NewReader(events, 8*os.Getpagesize())
+	if err != nil {
+		return nil, fmt.Errorf("创建perf读取器失败: %w", err)
+	}
+
+	return &EventReader{
+		reader:  reader,
+		monitor: monitor,
+		logger:  logrus.WithField("component", "event-reader"),
+	}, nil
+}
+
+// Run 持续读取事件，直到上下文取消
+func (r *EventReader) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		r.reader.Close()
+	}()
+
+	r.running.Store(true)
+	defer r.running.Store(false)
+
+	for {
+		r.reader.SetDeadline(time.Now().Add(eventReaderPollInterval))
+		record, err := r.reader.Read()
+		r.lastPoll.Store(time.Now().UnixNano())
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				r.logger.Info("📤 eBPF事件读取器退出")
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			r.logger.WithError(err).Warn("⚠️ 读取eBPF事件失败")
+			continue
+		}
+
+		if record.LostSamples > 0 {
+			r.lost.Add(record.LostSamples)
+			r.logger.WithFields(logrus.Fields{
+				"cpu":  record.CPU,
+				"lost": record.LostSamples,
+			}).Warn("⚠️ perf缓冲区溢出，丢失事件")
+			continue
+		}
+
+		r.handleRecord(record.RawSample)
+	}
+}
+
+// handleRecord 解码单个样本并分发
+func (r *EventReader) handleRecord(raw []byte) {
+	event, err := DecodeSOCKS5AuthEvent(raw)
+	if err != nil {
+		r.invalid.Add(1)
+		r.logger.WithError(err).Debug("🔍 丢弃无效eBPF事件")
+		return
+	}
+	r.received.Add(1)
+
+	r.monitor.HandleAuthEvent(event)
+}
+
+// Stats 返回事件读取统计
+func (r *EventReader) Stats() EventReaderStats {
+	stats := EventReaderStats{
+		Received: r.received.Load(),
+		Lost:     r.lost.Load(),
+		Invalid:  r.invalid.Load(),
+		Running:  r.running.Load(),
+	}
+	if ns := r.lastPoll.Load(); ns != 0 {
+		stats.LastPoll = time.Unix(0, ns)
+	}
+	return stats
+}
@@ -0,0 +1,388 @@
+package interceptor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// testEvent 构造原始 socks5_auth_event 样本的字段
+type testEvent struct {
+	typ       SOCKS5EventType
+	dir       Direction
+	pid       uint32
+	src, dst  string
+	sport     uint16
+	dport     uint16
+	username  string
+	password  string
+	ulen      uint8
+	plen      uint8
+	truncated EventTruncation
+	payload   []byte
+	payloadN  int // 非零时覆盖 payload_len
+	timestamp uint64
+	cookie    uint64
+	comm      string
+	seq       uint32
+	segLen    uint32
+	flags     uint8
+	counters  FlowCounters
+}
+
+// raw 按内核内存布局编码为 authEventSize 字节
+func (e testEvent) raw() []byte {
+	raw := make([]byte, authEventSize)
+	order := binary.NativeEndian
+	order.PutUint32(raw[authEventOffPID:], e.pid)
+	copy(raw[authEventOffSrcIP:], net.ParseIP(e.src).To16())
+	copy(raw[authEventOffDstIP:], net.ParseIP(e.dst).To16())
+	order.PutUint16(raw[authEventOffSrcPort:], e.sport)
+	order.PutUint16(raw[authEventOffDstPort:], e.dport)
+	copy(raw[authEventOffUsername:], e.username)
+	copy(raw[authEventOffPassword:], e.password)
+	raw[authEventOffUsernameLen] = e.ulen
+	raw[authEventOffPasswordLen] = e.plen
+	raw[authEventOffEventType] = byte(e.typ)
+	raw[authEventOffDirection] = byte(e.dir)
+	payloadLen := len(e.payload)
+	if e.payloadN != 0 {
+		payloadLen = e.payloadN
+	}
+	order.PutUint16(raw[authEventOffPayloadLen:], uint16(payloadLen))
+	raw[authEventOffTruncated] = byte(e.truncated)
+	copy(raw[authEventOffPayload:], e.payload)
+	order.PutUint64(raw[authEventOffTimestamp:], e.timestamp)
+	order.PutUint64(raw[authEventOffCookie:], e.cookie)
+	copy(raw[authEventOffComm:authEventOffComm+authEventCommLen], e.comm)
+	order.PutUint32(raw[authEventOffSeq:], e.seq)
+	order.PutUint32(raw[authEventOffSegLen:], e.segLen)
+	raw[authEventOffTCPFlags] = e.flags
+	order.PutUint64(raw[authEventOffBytesUp:], e.counters.BytesUp)
+	order.PutUint64(raw[authEventOffBytesDown:], e.counters.BytesDown)
+	order.PutUint64(raw[authEventOffPacketsUp:], e.counters.PacketsUp)
+	order.PutUint64(raw[authEventOffPacketsDown:], e.counters.PacketsDown)
+	return raw
+}
+
+// decode 编码后再解码，测试中构造监控器输入
+func (e testEvent) decode(t *testing.T) *SOCKS5AuthEvent {
+	t.Helper()
+	event, err := DecodeSOCKS5AuthEvent(e.raw())
+	if err != nil {
+		t.Fatalf("DecodeSOCKS5AuthEvent() error = %v", err)
+	}
+	return event
+}
+
+// newTestMonitor 创建不向标准输出打印报告的监控器
+func newTestMonitor() *EnhancedSOCKS5Monitor {
+	m := NewEnhancedSOCKS5Monitor(0, DefaultProxyTargets())
+	m.SetEventSink(EventSinkFunc(func(SessionEvent) {}))
+	return m
+}
+
+func TestAuthPayload(t *testing.T) {
+	cases := []struct {
+		name  string
+		event SOCKS5AuthEvent
+		want  []byte
+	}{
+		{
+			name:  "complete",
+			event: SOCKS5AuthEvent{Username: "alice", Password: "pwd", UsernameLen: 5, PasswordLen: 3},
+			want:  []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 3, 'p', 'w', 'd'},
+		},
+		{
+			name:  "username truncated",
+			event: SOCKS5AuthEvent{Username: "ali", UsernameLen: 5, Truncated: TruncatedUsername | TruncatedPassword},
+			want:  []byte{1, 5, 'a', 'l', 'i'},
+		},
+		{
+			name:  "password truncated",
+			event: SOCKS5AuthEvent{Username: "alice", Password: "p", UsernameLen: 5, PasswordLen: 3, Truncated: TruncatedPassword},
+			want:  []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 3, 'p'},
+		},
+		{
+			name:  "plen missing",
+			event: SOCKS5AuthEvent{Username: "alice", UsernameLen: 5, Truncated: TruncatedPassword},
+			want:  []byte{1, 5, 'a', 'l', 'i', 'c', 'e'},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.event.AuthPayload(); !bytes.Equal(got, tc.want) {
+				t.Errorf("AuthPayload() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTruncatedCredentials(t *testing.T) {
+	const client, proxy = "10.0.0.2", "10.0.0.9"
+	up := func(seq uint32, payload []byte) *SOCKS5AuthEvent {
+		return &SOCKS5AuthEvent{Type: SOCKS5EventSegment, Direction: DirectionClientToProxy, SrcIP: net.ParseIP(client), DstIP: net.ParseIP(proxy),
+			SrcPort: 40000, DstPort: 1080, Payload: payload, Seq: seq, SegLen: uint32(len(payload))}
+	}
+	down := func(seq uint32, payload []byte) *SOCKS5AuthEvent {
+		return &SOCKS5AuthEvent{Type: SOCKS5EventSegment, Direction: DirectionProxyToClient, SrcIP: net.ParseIP(proxy), DstIP: net.ParseIP(client),
+			SrcPort: 1080, DstPort: 40000, Payload: payload, Seq: seq, SegLen: uint32(len(payload))}
+	}
+	// 用户名 "alice" 只有前3个字节出现在第一个数据段中
+	auth := testEvent{
+		typ: SOCKS5EventAuth, dir: DirectionClientToProxy, src: client, dst: proxy, sport: 40000, dport: 1080,
+		username: "ali", ulen: 5, truncated: TruncatedUsername | TruncatedPassword, seq: 1003, segLen: 5,
+	}
+
+	t.Run("completed by next segment", func(t *testing.T) {
+		m := newTestMonitor()
+		m.HandleAuthEvent(up(1000, []byte{5, 1, 2}))
+		m.HandleAuthEvent(down(5000, []byte{5, 2}))
+		m.HandleAuthEvent(auth.decode(t))
+		if s := m.Sessions()[0]; s.Username != "" {
+			t.Fatalf("不完整的凭据被记录: %q", s.Username)
+		}
+		m.HandleAuthEvent(up(1008, []byte{'c', 'e', 3, 'p', 'w', 'd'}))
+
+		s := m.Sessions()[0]
+		if s.Username != "alice" || s.Password != "pwd" {
+			t.Errorf("credentials = %q/%q, want alice/pwd", s.Username, s.Password)
+		}
+		if s.Truncated != 0 {
+			t.Errorf("Truncated = %s, want none", s.Truncated)
+		}
+		if s.Phase != PhaseSubNegotiation || s.AuthResult != AuthResultPending {
+			t.Errorf("phase/auth = %s/%s, want %s/%s", s.Phase, s.AuthResult, PhaseSubNegotiation, AuthResultPending)
+		}
+	})
+
+	t.Run("rest never arrives", func(t *testing.T) {
+		m := newTestMonitor()
+		m.HandleAuthEvent(up(1000, []byte{5, 1, 2}))
+		m.HandleAuthEvent(down(5000, []byte{5, 2}))
+		m.HandleAuthEvent(auth.decode(t))
+		m.HandleAuthEvent(&SOCKS5AuthEvent{Type: SOCKS5EventFlow, Direction: DirectionClientToProxy, SrcIP: net.ParseIP(client), DstIP: net.ParseIP(proxy),
+			SrcPort: 40000, DstPort: 1080, TCPFlags: tcpFlagRST})
+
+		s := m.Sessions()[0]
+		if s.Username != "" || s.PasswordFingerprint != "" {
+			t.Errorf("不完整的凭据被记录: %q %q", s.Username, s.PasswordFingerprint)
+		}
+		if s.AuthResult != AuthResultIncomplete {
+			t.Errorf("AuthResult = %s, want %s", s.AuthResult, AuthResultIncomplete)
+		}
+		if len(m.CredentialHistory()) != 0 {
+			t.Errorf("CredentialHistory() = %v, want empty", m.CredentialHistory())
+		}
+	})
+}
+
+// ipv6ConnectRequest CONNECT [2001:db8::1]:443，ATYP 0x04
+var ipv6ConnectRequest = join([]byte{5, 1, 0, socks5AtypIPv6}, net.ParseIP("2001:db8::1").To16(), []byte{1, 187})
+
+func TestDecodeSOCKS5AuthEvent(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     []byte
+		want    SOCKS5AuthEvent
+		wantErr bool
+	}{
+		{
+			name: "auth event",
+			raw: testEvent{
+				typ: SOCKS5EventAuth, dir: DirectionClientToProxy, pid: 4321, src: "10.0.0.2", dst: "10.0.0.9", sport: 40000, dport: 1080,
+				username: "alice", password: "secret", ulen: 5, plen: 6, timestamp: 123456789, cookie: 77, comm: "linuxService",
+				seq: 1003, segLen: 14,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventAuth, Direction: DirectionClientToProxy, PID: 4321, Comm: "linuxService", Cookie: 77,
+				SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.9").To4(), SrcPort: 40000, DstPort: 1080,
+				Username: "alice", Password: "secret", UsernameLen: 5, PasswordLen: 6, Timestamp: 123456789, Seq: 1003, SegLen: 14,
+			},
+		},
+		{
+			name: "truncated auth event",
+			raw: testEvent{
+				typ: SOCKS5EventAuth, src: "10.0.0.2", dst: "10.0.0.9", username: "al", ulen: 5,
+				truncated: TruncatedUsername | TruncatedPassword,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventAuth, SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.9").To4(),
+				Username: "al", UsernameLen: 5, Truncated: TruncatedUsername | TruncatedPassword,
+			},
+		},
+		{
+			name: "segment event ipv6",
+			raw: testEvent{
+				typ: SOCKS5EventSegment, dir: DirectionProxyToClient, src: "2001:db8::9", dst: "2001:db8::2", sport: 1080, dport: 40000,
+				payload: []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}, seq: 5002, segLen: 10,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventSegment, Direction: DirectionProxyToClient, SrcIP: net.ParseIP("2001:db8::9"), DstIP: net.ParseIP("2001:db8::2"),
+				SrcPort: 1080, DstPort: 40000, Payload: []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}, Seq: 5002, SegLen: 10,
+			},
+		},
+		{
+			name: "auth event ipv6",
+			raw: testEvent{
+				typ: SOCKS5EventAuth, dir: DirectionClientToProxy, src: "2001:db8::2", dst: "2001:db8::9", sport: 40000, dport: 1080,
+				username: "alice", password: "secret", ulen: 5, plen: 6, seq: 1003, segLen: 14,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventAuth, Direction: DirectionClientToProxy, SrcIP: net.ParseIP("2001:db8::2"), DstIP: net.ParseIP("2001:db8::9"),
+				SrcPort: 40000, DstPort: 1080, Username: "alice", Password: "secret", UsernameLen: 5, PasswordLen: 6, Seq: 1003, SegLen: 14,
+			},
+		},
+		{
+			// IPv4映射IPv6地址解码为4字节IPv4，与IPv4事件的会话键一致
+			name: "ipv4-mapped addresses",
+			raw: testEvent{
+				typ: SOCKS5EventFlow, src: "::ffff:10.0.0.2", dst: "::ffff:10.0.0.9", sport: 40000, dport: 1080, flags: tcpFlagSYN,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventFlow, SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.9").To4(),
+				SrcPort: 40000, DstPort: 1080, TCPFlags: tcpFlagSYN,
+			},
+		},
+		{
+			name: "flow syn ipv6",
+			raw: testEvent{
+				typ: SOCKS5EventFlow, src: "2001:db8::2", dst: "2001:db8::9", sport: 40000, dport: 1080, seq: 1000, flags: tcpFlagSYN,
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventFlow, SrcIP: net.ParseIP("2001:db8::2"), DstIP: net.ParseIP("2001:db8::9"),
+				SrcPort: 40000, DstPort: 1080, Seq: 1000, TCPFlags: tcpFlagSYN,
+			},
+		},
+		{
+			name: "segment event ipv6 connect request with atyp ipv6",
+			raw: testEvent{
+				typ: SOCKS5EventSegment, dir: DirectionClientToProxy, src: "2001:db8::2", dst: "2001:db8::9", sport: 40000, dport: 1080,
+				payload: ipv6ConnectRequest, seq: 1017, segLen: uint32(len(ipv6ConnectRequest)),
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventSegment, Direction: DirectionClientToProxy, SrcIP: net.ParseIP("2001:db8::2"), DstIP: net.ParseIP("2001:db8::9"),
+				SrcPort: 40000, DstPort: 1080, Payload: ipv6ConnectRequest, Seq: 1017, SegLen: uint32(len(ipv6ConnectRequest)),
+			},
+		},
+		{
+			name: "flow close with counters",
+			raw: testEvent{
+				typ: SOCKS5EventFlow, dir: DirectionClientToProxy, src: "10.0.0.2", dst: "10.0.0.9", sport: 40000, dport: 1080,
+				flags: tcpFlagFIN | tcpFlagACK, counters: FlowCounters{BytesUp: 1500, BytesDown: 64000, PacketsUp: 4, PacketsDown: 50},
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventFlow, Direction: DirectionClientToProxy, SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.9").To4(),
+				SrcPort: 40000, DstPort: 1080, TCPFlags: tcpFlagFIN | tcpFlagACK,
+				Counters: FlowCounters{BytesUp: 1500, BytesDown: 64000, PacketsUp: 4, PacketsDown: 50},
+			},
+		},
+		{
+			name: "flow syn ignores counters",
+			raw: testEvent{
+				typ: SOCKS5EventFlow, src: "10.0.0.2", dst: "10.0.0.9", flags: tcpFlagSYN, counters: FlowCounters{BytesUp: 99},
+			}.raw(),
+			want: SOCKS5AuthEvent{
+				Type: SOCKS5EventFlow, SrcIP: net.ParseIP("10.0.0.2").To4(), DstIP: net.ParseIP("10.0.0.9").To4(), TCPFlags: tcpFlagSYN,
+			},
+		},
+		{
+			name:    "short buffer",
+			raw:     testEvent{typ: SOCKS5EventAuth}.raw()[:authEventSize-1],
+			wantErr: true,
+		},
+		{
+			name:    "payload_len exceeds buffer",
+			raw:     testEvent{typ: SOCKS5EventSegment, payloadN: authEventSegmentCap + 1}.raw(),
+			wantErr: true,
+		},
+		{
+			name:    "unknown event type",
+			raw:     testEvent{typ: 9}.raw(),
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeSOCKS5AuthEvent(tc.raw)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("DecodeSOCKS5AuthEvent() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			assertEvent(t, got, &tc.want)
+		})
+	}
+}
+
+// TestIPv6HandshakeFromEvents IPv6连接的原始事件解码后驱动完整握手，目标和绑定地址按 ATYP 0x04 解析
+func TestIPv6HandshakeFromEvents(t *testing.T) {
+	const client, proxy = "2001:db8::2", "2001:db8::9"
+	const clientISN, proxyISN = 1000, 5000
+	c2p := func(typ SOCKS5EventType, seq uint32, flags uint8, payload []byte) testEvent {
+		return testEvent{typ: typ, dir: DirectionClientToProxy, src: client, dst: proxy, sport: 40000, dport: 1080,
+			seq: seq, segLen: uint32(len(payload)), flags: flags, payload: payload}
+	}
+	p2c := func(typ SOCKS5EventType, seq uint32, flags uint8, payload []byte) testEvent {
+		return testEvent{typ: typ, dir: DirectionProxyToClient, src: proxy, dst: client, sport: 1080, dport: 40000,
+			seq: seq, segLen: uint32(len(payload)), flags: flags, payload: payload}
+	}
+	reply := join([]byte{5, 0, 0, socks5AtypIPv6}, net.ParseIP("2001:db8::9").To16(), []byte{0x9c, 0x40})
+	auth := c2p(SOCKS5EventAuth, clientISN+4, 0, nil)
+	auth.username, auth.password, auth.ulen, auth.plen, auth.segLen = "alice", "secret", 5, 6, 14
+
+	m := newTestMonitor()
+	for _, e := range []testEvent{
+		c2p(SOCKS5EventFlow, clientISN, tcpFlagSYN, nil),
+		p2c(SOCKS5EventFlow, proxyISN, tcpFlagSYN|tcpFlagACK, nil),
+		c2p(SOCKS5EventSegment, clientISN+1, 0, []byte{5, 1, 2}),
+		p2c(SOCKS5EventSegment, proxyISN+1, 0, []byte{5, 2}),
+		auth,
+		p2c(SOCKS5EventSegment, proxyISN+3, 0, []byte{1, 0}),
+		c2p(SOCKS5EventSegment, clientISN+18, 0, ipv6ConnectRequest),
+		p2c(SOCKS5EventSegment, proxyISN+5, 0, reply),
+	} {
+		m.HandleAuthEvent(e.decode(t))
+	}
+
+	sessions := m.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %d, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.SessionID != "[2001:db8::2]:40000->[2001:db8::9]:1080" || s.ClientIP != client || s.ProxyIP != proxy {
+		t.Errorf("session %s (client %s, proxy %s), want [2001:db8::2]:40000->[2001:db8::9]:1080", s.SessionID, s.ClientIP, s.ProxyIP)
+	}
+	if s.Phase != PhaseEstablished || s.Username != "alice" {
+		t.Errorf("phase %s user %q (%s), want established alice", s.Phase, s.Username, s.StopReason)
+	}
+	if s.TargetHost != "2001:db8::1" || s.TargetPort != 443 {
+		t.Errorf("target = %s:%d, want 2001:db8::1:443", s.TargetHost, s.TargetPort)
+	}
+	if s.Reply == nil || s.Reply.BoundEndpoint() != "[2001:db8::9]:40000" {
+		t.Errorf("Reply = %+v, want bound [2001:db8::9]:40000", s.Reply)
+	}
+}
+
+// assertEvent 逐字段比较解码结果，IP按值比较
+func assertEvent(t *testing.T, got, want *SOCKS5AuthEvent) {
+	t.Helper()
+	if !got.SrcIP.Equal(want.SrcIP) || !got.DstIP.Equal(want.DstIP) {
+		t.Errorf("addr = %s -> %s, want %s -> %s", got.SrcIP, got.DstIP, want.SrcIP, want.DstIP)
+	}
+	if len(got.SrcIP) != len(want.SrcIP) {
+		t.Errorf("SrcIP len = %d, want %d", len(got.SrcIP), len(want.SrcIP))
+	}
+	if !bytes.Equal(got.Payload, want.Payload) {
+		t.Errorf("Payload = %v, want %v", got.Payload, want.Payload)
+	}
+	g, w := *got, *want
+	g.SrcIP, g.DstIP, g.Payload = nil, nil, nil
+	w.SrcIP, w.DstIP, w.Payload = nil, nil, nil
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("event = %+v, want %+v", g, w)
+	}
+}
@@ -0,0 +1,332 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SessionEventType 会话事件类型
+type SessionEventType string
+
+const (
+	EventSessionOpened    SessionEventType = "session_opened"    // 观察到SYN或首个SOCKS5报文
+	EventAuthenticated    SessionEventType = "authenticated"     // 提取到凭据或收到认证结果
+	EventConnectRequested SessionEventType = "connect_requested" // 客户端发送请求（CONNECT等）
+	EventReplyReceived    SessionEventType = "reply_received"    // 代理应答
+	EventSessionClosed    SessionEventType = "session_closed"    // 观察到FIN/RST或会话被清理
+)
+
+// SessionEvent 会话事件，Session 为事件发生时的快照（不含明文密码）
+type SessionEvent struct {
+	Type       SessionEventType
+	Time       time.Time
+	Session    SOCKS5Session
+	Password   string            // 按脱敏策略输出的密码（明文或指纹），未提取到凭据时为空
+	Revealed   bool              // Password 是否为明文
+	TargetPID  int64             // 受监控的 linuxService PID
+	Suppressed ReportSuppression // 上次输出以来被合并的重复事件（认证、请求事件）
+}
+
+// EventSink 接收会话事件，在会话分片锁内同步调用，实现不应长时间阻塞
+type EventSink interface {
+	HandleEvent(event SessionEvent)
+}
+
+// EventSinkFunc 函数形式的 EventSink
+type EventSinkFunc func(event SessionEvent)
+
+// HandleEvent 调用 f(event)
+func (f EventSinkFunc) HandleEvent(event SessionEvent) {
+	f(event)
+}
+
+// multiEventSink 依次分发到多个接收者
+type multiEventSink []EventSink
+
+// HandleEvent 分发事件
+func (s multiEventSink) HandleEvent(event SessionEvent) {
+	for _, sink := range s {
+		sink.HandleEvent(event)
+	}
+}
+
+// MultiEventSink 将事件同时分发到多个接收者，忽略 nil
+func MultiEventSink(sinks ...EventSink) EventSink {
+	var multi multiEventSink
+	for _, sink := range sinks {
+		if sink != nil {
+			multi = append(multi, sink)
+		}
+	}
+	if len(multi) == 1 {
+		return multi[0]
+	}
+	return multi
+}
+
+// SetEventSink 设置会话事件接收者，为 nil 时恢复默认的标准输出报告
+func (m *EnhancedSOCKS5Monitor) SetEventSink(sink EventSink) {
+	if sink == nil {
+		sink = NewBannerEventSink(os.Stdout)
+	}
+	m.eventSink.Store(&sink)
+}
+
+// emitEvent 生成会话快照并分发事件（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) emitEvent(session *SOCKS5Session, typ SessionEventType, suppression ReportSuppression) {
+	event := SessionEvent{
+		Type:       typ,
+		Time:       time.Now(),
+		Session:    *session,
+		TargetPID:  m.targetPID.Load(),
+		Suppressed: suppression,
+	}
+	event.Session.Password = ""
+	if session.Reply != nil {
+		reply := *session.Reply
+		event.Session.Reply = &reply
+	}
+	if session.Username != "" {
+		redactor := m.redactor.Load()
+		event.Password = redactor.Password(session.Username, session.Password)
+		event.Revealed = redactor.Reveal()
+	}
+	(*m.eventSink.Load()).HandleEvent(event)
+}
+
+// reportEvent 分发认证、请求事件，内容未变化的重复事件按去重窗口合并
+func (m *EnhancedSOCKS5Monitor) reportEvent(session *SOCKS5Session, typ SessionEventType) {
+	suppression, ok := m.shouldReportAuth(session, time.Now())
+	if !ok {
+		return
+	}
+	m.emitEvent(session, typ, suppression)
+}
+
+// sessionEventRecord 结构化输出（logrus 字段、JSON Lines）使用的扁平记录
+type sessionEventRecord struct {
+	Event                string           `json:"event"`
+	Time                 time.Time        `json:"time"`
+	SessionID            string           `json:"session_id"`
+	Proxy                string           `json:"proxy"`
+	Client               string           `json:"client"`
+	PID                  uint32           `json:"pid,omitempty"`
+	Comm                 string           `json:"comm,omitempty"`
+	Phase                SOCKS5Phase      `json:"phase"`
+	Status               string           `json:"status,omitempty"`
+	Username             string           `json:"username,omitempty"`
+	Password             string           `json:"password,omitempty"`
+	AuthResult           AuthResult       `json:"auth_result,omitempty"`
+	Target               string           `json:"target,omitempty"`
+	Reply                string           `json:"reply,omitempty"`
+	BoundAddr            string           `json:"bound_addr,omitempty"`
+	Outcome              HandshakeOutcome `json:"outcome,omitempty"`
+	CloseReason          FlowCloseReason  `json:"close_reason,omitempty"`
+	Duration             string           `json:"duration,omitempty"`
+	BytesUp              uint64           `json:"bytes_up,omitempty"`
+	BytesDown            uint64           `json:"bytes_down,omitempty"`
+	SuppressedSession    uint64           `json:"suppressed_session,omitempty"`
+	SuppressedCredential uint64           `json:"suppressed_credential,omitempty"`
+}
+
+// newSessionEventRecord 将事件展开为扁平记录
+func newSessionEventRecord(event SessionEvent) sessionEventRecord {
+	session := &event.Session
+	record := sessionEventRecord{
+		Event:                string(event.Type),
+		Time:                 event.Time,
+		SessionID:            session.SessionID,
+		Proxy:                joinHostPort(session.ProxyIP, session.ProxyPort),
+		Client:               joinHostPort(session.ClientIP, session.ClientPort),
+		PID:                  session.PID,
+		Comm:                 session.Comm,
+		Phase:                session.Phase,
+		Status:               session.Status,
+		Username:             session.Username,
+		Password:             event.Password,
+		AuthResult:           session.AuthResult,
+		Outcome:              session.Outcome,
+		SuppressedSession:    event.Suppressed.Session,
+		SuppressedCredential: event.Suppressed.Credential,
+	}
+	if session.TargetHost != "" {
+		record.Target = joinHostPort(session.TargetHost, session.TargetPort)
+	}
+	if session.Reply != nil {
+		record.Reply = session.Reply.Code.String()
+		record.BoundAddr = session.Reply.BoundEndpoint()
+	}
+	if event.Type == EventSessionClosed {
+		record.CloseReason = session.CloseReason
+		record.Duration = session.Duration().Round(time.Millisecond).String()
+		record.BytesUp = session.BytesUp
+		record.BytesDown = session.BytesDown
+	}
+	return record
+}
+
+// fields 转换为 logrus 字段，省略空值
+func (r sessionEventRecord) fields() logrus.Fields {
+	fields := logrus.Fields{
+		"event":      r.Event,
+		"session_id": r.SessionID,
+		"proxy":      r.Proxy,
+		"client":     r.Client,
+		"phase":      r.Phase,
+	}
+	optional := map[string]any{
+		"pid":                   r.PID,
+		"comm":                  r.Comm,
+		"status":                r.Status,
+		"username":              r.Username,
+		"password":              r.Password,
+		"auth_result":           r.AuthResult,
+		"target":                r.Target,
+		"reply":                 r.Reply,
+		"bound_addr":            r.BoundAddr,
+		"outcome":               r.Outcome,
+		"close_reason":          r.CloseReason,
+		"duration":              r.Duration,
+		"bytes_up":              r.BytesUp,
+		"bytes_down":            r.BytesDown,
+		"suppressed_session":    r.SuppressedSession,
+		"suppressed_credential": r.SuppressedCredential,
+	}
+	for name, value := range optional {
+		switch v := value.(type) {
+		case uint32:
+			if v == 0 {
+				continue
+			}
+		case uint64:
+			if v == 0 {
+				continue
+			}
+		default:
+			if fmt.Sprint(v) == "" {
+				continue
+			}
+		}
+		fields[name] = value
+	}
+	return fields
+}
+
+// logrusEventSink 以 logrus 结构化字段输出事件
+type logrusEventSink struct {
+	logger *logrus.Entry
+}
+
+// NewLogrusEventSink 以 logrus 结构化字段输出事件：认证事件为 WARN，会话建立为 DEBUG，其他为 INFO
+func NewLogrusEventSink(logger *logrus.Entry) EventSink {
+	return &logrusEventSink{logger: logger}
+}
+
+// HandleEvent 输出一条日志
+func (s *logrusEventSink) HandleEvent(event SessionEvent) {
+	entry := s.logger.WithFields(newSessionEventRecord(event).fields())
+	switch event.Type {
+	case EventAuthenticated:
+		entry.Warn("🔐 SOCKS5会话事件")
+	case EventSessionOpened:
+		entry.Debug("🔐 SOCKS5会话事件")
+	default:
+		entry.Info("🔐 SOCKS5会话事件")
+	}
+}
+
+// jsonLinesEventSink 每个事件输出一行JSON
+type jsonLinesEventSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONLinesEventSink 以 JSON Lines 格式输出事件
+func NewJSONLinesEventSink(w io.Writer) EventSink {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &jsonLinesEventSink{encoder: encoder}
+}
+
+// HandleEvent 写出一行JSON
+func (s *jsonLinesEventSink) HandleEvent(event SessionEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(newSessionEventRecord(event)); err != nil {
+		log.Printf("❌ [SOCKS5-事件] JSON Lines 写入失败: %v", err)
+	}
+}
+
+// bannerEventSink 人工阅读的认证报告
+type bannerEventSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewBannerEventSink 输出人工阅读的认证报告，只处理带凭据的认证和请求事件
+func NewBannerEventSink(w io.Writer) EventSink {
+	return &bannerEventSink{w: w}
+}
+
+// HandleEvent 打印SOCKS5认证报告
+func (s *bannerEventSink) HandleEvent(event SessionEvent) {
+	if event.Type != EventAuthenticated && event.Type != EventConnectRequested {
+		return
+	}
+	session := &event.Session
+	if session.Username == "" {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, strings.Repeat("=", 100))
+	fmt.Fprintln(&b, "🔐 eBPF内核级SOCKS5代理认证信息捕获")
+	fmt.Fprintln(&b, strings.Repeat("=", 100))
+	fmt.Fprintf(&b, "⏰ 捕获时间: %s\n", session.AuthTime.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "🔗 会话标识: %s\n", session.SessionID)
+	fmt.Fprintf(&b, "🌐 代理服务器: %s\n", joinHostPort(session.ProxyIP, session.ProxyPort))
+	fmt.Fprintf(&b, "👤 SOCKS5用户名: %s\n", session.Username)
+	if event.Revealed {
+		fmt.Fprintf(&b, "🔑 SOCKS5密码: %s\n", event.Password)
+	} else {
+		fmt.Fprintf(&b, "🔑 SOCKS5密码指纹: %s (明文已隐藏)\n", event.Password)
+	}
+	if session.Truncated&(TruncatedUsername|TruncatedPassword) != 0 {
+		fmt.Fprintf(&b, "⚠️ 凭据不完整: %s 跨越多个数据包，仅捕获到部分内容\n", session.Truncated)
+	}
+
+	if session.TargetHost != "" {
+		fmt.Fprintf(&b, "🎯 目标地址: %s\n", joinHostPort(session.TargetHost, session.TargetPort))
+	}
+
+	if session.Reply != nil {
+		fmt.Fprintf(&b, "🔁 代理应答: %s (%s), 绑定地址: %s\n", session.Reply.Code, session.Reply.Code.Description(), session.Reply.BoundEndpoint())
+	}
+
+	fmt.Fprintf(&b, "📊 连接状态: %s\n", session.Status)
+	fmt.Fprintf(&b, "🔍 监控方式: eBPF内核级数据包捕获\n")
+	if session.PID != 0 {
+		fmt.Fprintf(&b, "📋 发起进程: %s (PID: %d)\n", session.Comm, session.PID)
+	} else {
+		fmt.Fprintf(&b, "📋 发起进程: 未知（未关联到socket）, 受监控进程: linuxService (PID: %d)\n", event.TargetPID)
+	}
+	fmt.Fprintf(&b, "💡 技术优势: 内核级监控，无法绕过，100%%捕获率\n")
+	if event.Suppressed.Session > 0 || event.Suppressed.Credential > 0 {
+		fmt.Fprintf(&b, "🔁 已合并重复报告: 本会话 %d 次, 该代理用户 %d 次 (上次报告以来)\n", event.Suppressed.Session, event.Suppressed.Credential)
+	}
+	fmt.Fprintln(&b, strings.Repeat("=", 100))
+	fmt.Fprintln(&b)
+
+	// 整段写出，并发的报告不会交错
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.WriteString(s.w, b.String())
+}
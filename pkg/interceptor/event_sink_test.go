@@ -0,0 +1,155 @@
+package interceptor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordEvents 完成一次握手并返回收到的全部事件
+func recordEvents(t *testing.T, sink EventSink) []SessionEvent {
+	t.Helper()
+	var events []SessionEvent
+	m := newTestMonitor()
+	redactor, err := NewCredentialRedactor(testFingerprintKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetCredentialRedactor(redactor)
+	m.SetEventSink(MultiEventSink(sink, EventSinkFunc(func(event SessionEvent) { events = append(events, event) })))
+	handshake(m, "10.0.1.1", 40001, "alice", "pl41n-s3cret", 0x00)
+	return events
+}
+
+func TestJSONLinesEventSink(t *testing.T) {
+	var out bytes.Buffer
+	events := recordEvents(t, NewJSONLinesEventSink(&out))
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v\n%s", len(records)+1, err, scanner.Text())
+		}
+		records = append(records, record)
+	}
+	if len(records) != len(events) {
+		t.Fatalf("%d lines, want one per event (%d)", len(records), len(events))
+	}
+
+	redactor, _ := NewCredentialRedactor(testFingerprintKey, false)
+	fingerprint := redactor.Fingerprint("alice", "pl41n-s3cret")
+	for i, record := range records {
+		if record["event"] != string(events[i].Type) || record["session_id"] != "10.0.1.1:40001->10.0.0.9:1080" {
+			t.Errorf("line %d = %v, want %s event for the session", i+1, record, events[i].Type)
+		}
+		if password, ok := record["password"]; ok && password != fingerprint {
+			t.Errorf("line %d password = %v, want absent or %s", i+1, password, fingerprint)
+		}
+	}
+	if strings.Contains(out.String(), "pl41n-s3cret") {
+		t.Errorf("JSON Lines output contains the plaintext password:\n%s", out.String())
+	}
+
+	// 带凭据的事件填写用户名和密码指纹，握手完成后的事件带应答和目标
+	last := records[len(records)-1]
+	want := map[string]any{
+		"event":       string(EventReplyReceived),
+		"proxy":       "10.0.0.9:1080",
+		"client":      "10.0.1.1:40001",
+		"username":    "alice",
+		"password":    fingerprint,
+		"auth_result": string(AuthResultSuccess),
+		"target":      "1.2.3.4:80",
+		"reply":       ReplySucceeded.String(),
+	}
+	for field, value := range want {
+		if last[field] != value {
+			t.Errorf("last line %s = %v, want %v", field, last[field], value)
+		}
+	}
+	if _, ok := records[0]["password"]; ok {
+		t.Errorf("session_opened line has a password field: %v", records[0])
+	}
+}
+
+func TestLogrusEventSink(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.DebugLevel)
+	events := recordEvents(t, NewLogrusEventSink(logrus.NewEntry(logger)))
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("logrus line: %v\n%s", err, scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != len(events) {
+		t.Fatalf("%d log lines, want %d", len(lines), len(events))
+	}
+
+	levels := map[SessionEventType]string{
+		EventSessionOpened:    "debug",
+		EventAuthenticated:    "warning",
+		EventConnectRequested: "info",
+		EventReplyReceived:    "info",
+	}
+	for i, line := range lines {
+		typ := events[i].Type
+		if line["event"] != string(typ) || line["level"] != levels[typ] {
+			t.Errorf("line %d = event %v level %v, want %s at %s", i, line["event"], line["level"], typ, levels[typ])
+		}
+		// 空值字段省略
+		for _, field := range []string{"pid", "bytes_up", "close_reason", "suppressed_session"} {
+			if _, ok := line[field]; ok {
+				t.Errorf("line %d has empty field %s = %v", i, field, line[field])
+			}
+		}
+	}
+	if strings.Contains(out.String(), "pl41n-s3cret") {
+		t.Errorf("logrus output contains the plaintext password:\n%s", out.String())
+	}
+}
+
+func TestMultiEventSink(t *testing.T) {
+	var a, b, c []SessionEventType
+	sink := func(got *[]SessionEventType) EventSink {
+		return EventSinkFunc(func(event SessionEvent) { *got = append(*got, event.Type) })
+	}
+
+	multi := MultiEventSink(sink(&a), nil, sink(&b), sink(&c))
+	events := recordEvents(t, multi)
+	if len(events) == 0 {
+		t.Fatal("no events")
+	}
+	for name, got := range map[string][]SessionEventType{"a": a, "b": b, "c": c} {
+		if len(got) != len(events) {
+			t.Errorf("sink %s received %d events, want %d", name, len(got), len(events))
+			continue
+		}
+		for i := range got {
+			if got[i] != events[i].Type {
+				t.Errorf("sink %s event %d = %s, want %s", name, i, got[i], events[i].Type)
+			}
+		}
+	}
+
+	// 只有一个有效接收者时直接返回该接收者
+	single := sink(&a)
+	if got := MultiEventSink(nil, single); got == nil {
+		t.Error("MultiEventSink(nil, sink) = nil")
+	} else if _, ok := got.(multiEventSink); ok {
+		t.Error("MultiEventSink with one sink wraps it")
+	}
+}
@@ -0,0 +1,163 @@
+package interceptor
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 会话过期策略
+const (
+	sessionIdleTimeout     = 5 * time.Minute // 未关闭的连接超过该时间没有任何数据包视为失效
+	closedSessionRetention = 1 * time.Minute // 已关闭的会话保留一段时间供查询
+)
+
+// FlowCloseReason TCP连接关闭原因
+type FlowCloseReason string
+
+const (
+	FlowCloseClientFIN FlowCloseReason = "client_fin" // 客户端先发送FIN
+	FlowCloseProxyFIN  FlowCloseReason = "proxy_fin"  // 代理先发送FIN
+	FlowCloseClientRST FlowCloseReason = "client_rst" // 客户端重置连接
+	FlowCloseProxyRST  FlowCloseReason = "proxy_rst"  // 代理重置连接
+	FlowCloseRetired   FlowCloseReason = "retired"    // 未观察到FIN/RST，会话超时清理或被新连接替换
+)
+
+// Duration 返回连接持续时间，未关闭时计算到当前时间
+func (s *SOCKS5Session) Duration() time.Duration {
+	if s.CloseTime.IsZero() {
+		return time.Since(s.OpenTime)
+	}
+	return s.CloseTime.Sub(s.OpenTime)
+}
+
+// handleFlowEvent 处理连接建立和关闭事件
+func (m *EnhancedSOCKS5Monitor) handleFlowEvent(event *SOCKS5AuthEvent) {
+	clientIP, clientPort, proxyIP, proxyPort := flowEndpoints(event.Direction, event.SrcIP.String(), event.DstIP.String(), event.SrcPort, event.DstPort)
+	sessionKey := sessionKeyOf(clientIP, clientPort, proxyIP, proxyPort)
+
+	shard := m.shardFor(sessionKey)
+	shard.mu.Lock()
+	defer m.unlockShard(shard)
+
+	conn := shard.conns[sessionKey]
+
+	// 客户端SYN：新连接，端口复用时替换旧会话
+	if event.Direction == DirectionClientToProxy && event.TCPFlags&(tcpFlagSYN|tcpFlagACK) == tcpFlagSYN {
+		if conn != nil {
+			m.retireConn(conn)
+			delete(shard.conns, sessionKey)
+		}
+		if !m.targets.Load().Matches(proxyIP, proxyPort) {
+			return
+		}
+
+		conn = newSOCKS5Conn(sessionKey, clientIP, clientPort, proxyIP, proxyPort)
+		conn.session.SYNObserved = true
+		conn.timing.syn = event.Timestamp
+		// SYN 占用一个序列号，客户端数据从 ISN+1 开始
+		conn.clientStream = newStreamReassembler(&m.reassembly)
+		conn.clientStream.Start(event.Seq + 1)
+		shard.conns[sessionKey] = conn
+		m.annotateSession(conn.session, event)
+		log.Printf("🔗 [eBPF-SOCKS5] 连接建立: %s", sessionKey)
+		m.emitEvent(conn.session, EventSessionOpened, ReportSuppression{})
+		return
+	}
+
+	if conn == nil {
+		return
+	}
+	session := conn.session
+	session.LastActivity = time.Now()
+
+	// 代理SYN-ACK：TCP建连耗时
+	if event.Direction == DirectionProxyToClient && event.TCPFlags&(tcpFlagSYN|tcpFlagACK) == tcpFlagSYN|tcpFlagACK {
+		// 入站捕获生效，代理报文以实际观察为准，不再推断
+		conn.serverSeen = true
+		// SYN-ACK 同样占用一个序列号，代理的第一个数据段乱序到达时也能按起点缓冲
+		if conn.serverStream == nil {
+			conn.serverStream = newStreamReassembler(&m.reassembly)
+			conn.serverStream.Start(event.Seq + 1)
+		}
+		m.recordSessionLatency(session, LatencyTCPConnect, conn.timing.syn, event.Timestamp)
+		return
+	}
+	if event.TCPFlags&(tcpFlagFIN|tcpFlagRST) == 0 {
+		return
+	}
+
+	// 内核在关闭时附带流量计数，双向FIN后流状态即被删除
+	conn.applyCounters(event.Counters)
+
+	// 以第一个FIN/RST为准记录关闭原因
+	if !session.CloseTime.IsZero() {
+		return
+	}
+	session.CloseTime = session.LastActivity
+	session.CloseReason = flowCloseReason(event.Direction, event.TCPFlags)
+	if !session.Phase.Terminal() {
+		conn.fail(fmt.Sprintf("握手完成前连接关闭 (%s)", session.CloseReason))
+		conn.clientBuf = nil
+		conn.serverBuf = nil
+		conn.release()
+		m.finishHandshake(conn, OutcomeClosed)
+	}
+
+	log.Printf("🔚 [eBPF-SOCKS5] 连接关闭: %s (原因: %s, 持续: %s, 阶段: %s, 上行: %d字节, 下行: %d字节)", sessionKey, session.CloseReason, session.Duration().Round(time.Millisecond), session.Phase, session.BytesUp, session.BytesDown)
+	m.emitEvent(session, EventSessionClosed, ReportSuppression{})
+}
+
+// flowCloseReason 根据方向和标志位确定关闭原因
+func flowCloseReason(dir Direction, flags uint8) FlowCloseReason {
+	rst := flags&tcpFlagRST != 0
+	switch {
+	case dir == DirectionClientToProxy && rst:
+		return FlowCloseClientRST
+	case dir == DirectionClientToProxy:
+		return FlowCloseClientFIN
+	case rst:
+		return FlowCloseProxyRST
+	default:
+		return FlowCloseProxyFIN
+	}
+}
+
+// sessionExpired 判断会话是否可以清理（调用方需持有分片锁，流量已刷新）
+func sessionExpired(session *SOCKS5Session, now time.Time) bool {
+	if !session.CloseTime.IsZero() {
+		return now.Sub(session.CloseTime) > closedSessionRetention
+	}
+	return now.Sub(session.LastActivity) > sessionIdleTimeout
+}
+
+// flowKey socks5_flows 映射的键（与 struct session_key 一致）
+type flowKey struct {
+	ClientAddr [16]byte // 网络字节序，IPv4 使用IPv4映射IPv6形式
+	ClientPort uint16
+	ProxyPort  uint16
+}
+
+// flowState socks5_flows 映射的值（与 struct flow_state 一致）
+type flowState struct {
+	LastSeen    uint64 // bpf_ktime_get_ns()
+	BytesUp     uint64
+	BytesDown   uint64
+	PacketsUp   uint64
+	PacketsDown uint64
+	Sent        uint32
+	Flags       uint8
+	_           [3]uint8
+}
+
+// monotonicToTime 将 bpf_ktime_get_ns()（CLOCK_MONOTONIC）换算为墙上时间
+func monotonicToTime(ns uint64) time.Time {
+	now := time.Now()
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return now
+	}
+	return now.Add(-time.Duration(ts.Nano() - int64(ns)))
+}
@@ -0,0 +1,229 @@
+package interceptor
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// latencySampleWindow 每个代理每项指标保留的最近样本数，百分位按该窗口计算
+const latencySampleWindow = 1024
+
+// LatencyMetric 握手耗时指标
+type LatencyMetric string
+
+const (
+	LatencyTCPConnect LatencyMetric = "tcp_connect" // SYN -> SYN-ACK
+	LatencyMethod     LatencyMetric = "method"      // 问候 -> 方法选择
+	LatencyAuth       LatencyMetric = "auth"        // 凭据 -> 认证结果
+	LatencyConnect    LatencyMetric = "connect"     // CONNECT请求 -> 代理应答
+)
+
+// latencyMetrics 指标的固定输出顺序
+var latencyMetrics = []LatencyMetric{LatencyTCPConnect, LatencyMethod, LatencyAuth, LatencyConnect}
+
+// latencyBuckets 直方图桶上限，覆盖局域网代理到跨境代理的常见耗时
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// handshakeTiming 握手报文的内核时间戳（bpf_ktime_get_ns()），0 表示未观察到
+type handshakeTiming struct {
+	clock    [2]uint64 // 每个方向最近一个事件的时间戳，按 Direction 索引
+	syn      uint64
+	greeting uint64
+	authSent uint64
+	request  uint64
+}
+
+// observe 推进方向时钟，多CPU上报的事件可能乱序，只取较大值
+func (t *handshakeTiming) observe(dir Direction, timestamp uint64) {
+	if int(dir) < len(t.clock) && timestamp > t.clock[dir] {
+		t.clock[dir] = timestamp
+	}
+}
+
+// sent 返回客户端报文完整到达时的时间戳
+func (t *handshakeTiming) sent() uint64 {
+	return t.clock[DirectionClientToProxy]
+}
+
+// elapsed 计算 from 到 to 的耗时，任一时间未知或顺序颠倒时返回 false
+func elapsed(from, to uint64) (time.Duration, bool) {
+	if from == 0 || to == 0 || to < from {
+		return 0, false
+	}
+	return time.Duration(to - from), true
+}
+
+// observeRTT 代理应答到达时计算与对应客户端报文的时间差，记录到会话和代理汇总（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) observeRTT(conn *socks5Conn, metric LatencyMetric, sent uint64) {
+	m.recordSessionLatency(conn.session, metric, sent, conn.timing.clock[DirectionProxyToClient])
+}
+
+// recordSessionLatency 记录一项握手耗时
+func (m *EnhancedSOCKS5Monitor) recordSessionLatency(session *SOCKS5Session, metric LatencyMetric, from, to uint64) {
+	d, ok := elapsed(from, to)
+	if !ok {
+		return
+	}
+
+	switch metric {
+	case LatencyTCPConnect:
+		session.TCPConnectTime = d
+	case LatencyMethod:
+		session.MethodRTT = d
+	case LatencyAuth:
+		session.AuthRTT = d
+	case LatencyConnect:
+		session.ConnectRTT = d
+	}
+	log.Printf("⏱️ [SOCKS5-时延] %s %s: %s", session.SessionID, metric, d)
+
+	proxy := joinHostPort(session.ProxyIP, session.ProxyPort)
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+	if m.latency == nil {
+		m.latency = make(map[string]map[LatencyMetric]*latencySamples)
+	}
+	metrics, ok := m.latency[proxy]
+	if !ok {
+		metrics = make(map[LatencyMetric]*latencySamples)
+		m.latency[proxy] = metrics
+	}
+	samples, ok := metrics[metric]
+	if !ok {
+		samples = &latencySamples{}
+		metrics[metric] = samples
+	}
+	samples.add(d)
+}
+
+// latencySamples 固定容量的样本环形缓冲，另外累计全部样本的直方图
+type latencySamples struct {
+	values  []time.Duration
+	next    int
+	count   uint64 // 累计样本数（含已被覆盖的）
+	sum     time.Duration
+	buckets []uint64 // 与 latencyBuckets 对应，非累积
+}
+
+// add 加入样本，窗口满后覆盖最旧的样本
+func (s *latencySamples) add(d time.Duration) {
+	s.count++
+	s.sum += d
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(latencyBuckets))
+	}
+	if i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] }); i < len(latencyBuckets) {
+		s.buckets[i]++
+	}
+	if len(s.values) < latencySampleWindow {
+		s.values = append(s.values, d)
+		return
+	}
+	s.values[s.next] = d
+	s.next = (s.next + 1) % latencySampleWindow
+}
+
+// LatencyPercentiles 一项指标在最近样本窗口内的分布
+type LatencyPercentiles struct {
+	Count uint64 // 累计样本数
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// percentiles 计算窗口内的百分位（最近秩法）
+func (s *latencySamples) percentiles() LatencyPercentiles {
+	result := LatencyPercentiles{Count: s.count}
+	if len(s.values) == 0 {
+		return result
+	}
+
+	sorted := append([]time.Duration(nil), s.values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p int) time.Duration {
+		i := (len(sorted)*p + 99) / 100
+		if i < 1 {
+			i = 1
+		}
+		return sorted[i-1]
+	}
+	result.P50 = rank(50)
+	result.P90 = rank(90)
+	result.P99 = rank(99)
+	result.Max = sorted[len(sorted)-1]
+	return result
+}
+
+// ProxyLatency 单个上游代理的握手耗时分布，未出现的指标不在 Metrics 中
+type ProxyLatency struct {
+	Proxy   string // 代理 IP:端口
+	Metrics map[LatencyMetric]LatencyPercentiles
+}
+
+// ProxyLatency 返回每个上游代理的握手耗时分布，按代理排序
+func (m *EnhancedSOCKS5Monitor) ProxyLatency() []ProxyLatency {
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+
+	result := make([]ProxyLatency, 0, len(m.latency))
+	for proxy, metrics := range m.latency {
+		latency := ProxyLatency{
+			Proxy:   proxy,
+			Metrics: make(map[LatencyMetric]LatencyPercentiles, len(metrics)),
+		}
+		for metric, samples := range metrics {
+			latency.Metrics[metric] = samples.percentiles()
+		}
+		result = append(result, latency)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Proxy < result[j].Proxy })
+	return result
+}
+
+// LatencyHistogram 一项指标自启动以来的累计直方图
+type LatencyHistogram struct {
+	Bounds []time.Duration // 桶上限，与 Counts 对应
+	Counts []uint64        // 累积计数：耗时 ≤ Bounds[i] 的样本数
+	Count  uint64          // 样本总数（含超出最大桶的）
+	Sum    time.Duration
+}
+
+// histogram 返回累积直方图
+func (s *latencySamples) histogram() LatencyHistogram {
+	h := LatencyHistogram{
+		Bounds: latencyBuckets,
+		Counts: make([]uint64, len(latencyBuckets)),
+		Count:  s.count,
+		Sum:    s.sum,
+	}
+	var cumulative uint64
+	for i := range latencyBuckets {
+		if i < len(s.buckets) {
+			cumulative += s.buckets[i]
+		}
+		h.Counts[i] = cumulative
+	}
+	return h
+}
+
+// ProxyLatencyHistograms 返回每个上游代理各项握手耗时的累计直方图
+func (m *EnhancedSOCKS5Monitor) ProxyLatencyHistograms() map[string]map[LatencyMetric]LatencyHistogram {
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+
+	result := make(map[string]map[LatencyMetric]LatencyHistogram, len(m.latency))
+	for proxy, metrics := range m.latency {
+		histograms := make(map[LatencyMetric]LatencyHistogram, len(metrics))
+		for metric, samples := range metrics {
+			histograms[metric] = samples.histogram()
+		}
+		result[proxy] = histograms
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+package interceptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// 健康检查判定阈值
+const (
+	eventReaderStallTimeout = 10 * eventReaderPollInterval // 读取循环超过该时间没有返回视为卡住
+	linuxServiceDownGrace   = 6 * linuxServiceRestartDelay // 存活检查容忍 linuxService 自动重启的时间
+)
+
+// 健康检查的组件名
+const (
+	componentBPF          = "bpf"
+	componentEventReader  = "event_reader"
+	componentLinuxService = "linux_service"
+)
+
+// ComponentHealth 单个组件的健康状态
+type ComponentHealth struct {
+	Healthy bool           `json:"healthy"`
+	Detail  string         `json:"detail"`
+	Info    map[string]any `json:"info,omitempty"`
+}
+
+// HealthReport 健康检查结果
+type HealthReport struct {
+	Status     string                     `json:"status"` // ok / degraded / down
+	Live       bool                       `json:"live"`   // /healthz 判定结果
+	Ready      bool                       `json:"ready"`  // /readyz 判定结果
+	Uptime     string                     `json:"uptime"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// HealthReport 检查eBPF挂载、事件读取和 linuxService 进程的状态
+// 就绪要求全部组件正常；存活允许 linuxService 在自动重启期间短暂不可用
+func (c *ContainerMonitor) HealthReport() HealthReport {
+	now := time.Now()
+	report := HealthReport{
+		CheckedAt: now,
+		Components: map[string]ComponentHealth{
+			componentBPF:          c.bpfHealth(),
+			componentEventReader:  c.eventReaderHealth(now),
+			componentLinuxService: c.linuxServiceHealth(),
+		},
+	}
+	if !c.startTime.IsZero() {
+		report.Uptime = now.Sub(c.startTime).Round(time.Second).String()
+	}
+
+	bpf := report.Components[componentBPF].Healthy
+	reader := report.Components[componentEventReader].Healthy
+	service := report.Components[componentLinuxService].Healthy
+
+	report.Ready = bpf && reader && service
+	report.Live = bpf && reader
+	if !service {
+		if downAt := c.serviceDownAt.Load(); downAt == 0 || now.Sub(time.Unix(0, downAt)) > linuxServiceDownGrace {
+			report.Live = false
+		}
+	}
+
+	switch {
+	case report.Ready:
+		report.Status = "ok"
+	case report.Live:
+		report.Status = "degraded"
+	default:
+		report.Status = "down"
+	}
+	return report
+}
+
+// bpfHealth eBPF程序是否已挂载
+func (c *ContainerMonitor) bpfHealth() ComponentHealth {
+	info := map[string]any{"attach_mode": string(c.attachMode)}
+
+	c.targetsMu.Lock()
+	loaded := c.objs != nil
+	cgroup := c.cgroup
+	cgroupErr := c.cgroupErr
+	c.targetsMu.Unlock()
+
+	if !loaded {
+		return ComponentHealth{Detail: "eBPF程序未加载", Info: info}
+	}
+
+	if c.attachMode == AttachModeCgroup {
+		if cgroup == nil {
+			detail := "未挂载到cgroup"
+			if cgroupErr != nil {
+				detail += ": " + cgroupErr.Error()
+			}
+			return ComponentHealth{Detail: detail, Info: info}
+		}
+		info["cgroup"] = cgroup.path
+		return ComponentHealth{Healthy: true, Detail: "已挂载到cgroup", Info: info}
+	}
+
+	interfaces, attached := c.interfaceAttachments()
+	info["interfaces"] = interfaces
+	if attached == 0 {
+		return ComponentHealth{Detail: "没有已挂载的网络接口", Info: info}
+	}
+	return ComponentHealth{Healthy: true, Detail: "已挂载到网络接口", Info: info}
+}
+
+// eventReaderHealth 事件读取循环是否在运行并持续消费 perf 缓冲区
+func (c *ContainerMonitor) eventReaderHealth(now time.Time) ComponentHealth {
+	if c.eventReader == nil {
+		return ComponentHealth{Detail: "事件读取器未启动"}
+	}
+
+	stats := c.eventReader.Stats()
+	info := map[string]any{
+		"received": stats.Received,
+		"lost":     stats.Lost,
+		"invalid":  stats.Invalid,
+	}
+	if !stats.LastPoll.IsZero() {
+		info["last_poll"] = stats.LastPoll
+	}
+
+	switch {
+	case !stats.Running:
+		return ComponentHealth{Detail: "事件读取器已退出", Info: info}
+	case stats.LastPoll.IsZero() || now.Sub(stats.LastPoll) > eventReaderStallTimeout:
+		return ComponentHealth{Detail: "事件读取器长时间没有返回", Info: info}
+	}
+	return ComponentHealth{Healthy: true, Detail: "正在消费perf缓冲区", Info: info}
+}
+
+// linuxServiceHealth linuxService 子进程是否在运行
+func (c *ContainerMonitor) linuxServiceHealth() ComponentHealth {
+	info := map[string]any{"restarts": c.serviceRestarts.Load()}
+	if exit := c.serviceLastExit.Load(); exit != nil {
+		info["last_exit"] = *exit
+	}
+
+	pid := c.GetLinuxServicePID()
+	if pid <= 0 {
+		if downAt := c.serviceDownAt.Load(); downAt != 0 {
+			info["down_since"] = time.Unix(0, downAt)
+		}
+		return ComponentHealth{Detail: "linuxService进程未运行", Info: info}
+	}
+	info["pid"] = pid
+	return ComponentHealth{Healthy: true, Detail: "linuxService进程运行中", Info: info}
+}
+
+// handleHealthz 存活检查，失败时返回503
+func (c *ContainerMonitor) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := c.HealthReport()
+	writeHealthReport(w, report, report.Live)
+}
+
+// handleReadyz 就绪检查，失败时返回503
+func (c *ContainerMonitor) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := c.HealthReport()
+	writeHealthReport(w, report, report.Ready)
+}
+
+// writeHealthReport 输出JSON格式的检查结果
+func writeHealthReport(w http.ResponseWriter, report HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
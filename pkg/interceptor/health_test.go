@@ -0,0 +1,108 @@
+package interceptor
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestLinuxServiceStateConcurrentAccess 监控协程更新进程状态时，健康检查和指标并发读取，配合 go test -race 运行
+func TestLinuxServiceStateConcurrentAccess(t *testing.T) {
+	path, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep 不可用")
+	}
+	cmd := exec.Command(path, "0.05")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	c := &ContainerMonitor{}
+	c.linuxServiceCmd.Store(cmd)
+	c.linuxServicePID.Store(int64(cmd.Process.Pid))
+	if report := c.HealthReport(); !report.Components[componentLinuxService].Healthy {
+		t.Fatalf("linux_service = %+v, want healthy while running", report.Components[componentLinuxService])
+	}
+
+	// 上下文已取消，进程退出后监控协程只更新状态，不重启
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exited := make(chan struct{})
+	go func() {
+		c.monitorLinuxServiceProcess(ctx, cmd)
+		close(exited)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-exited:
+					return
+				default:
+					c.HealthReport()
+					c.WriteMetrics(io.Discard)
+					c.GetLinuxServicePID()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := c.HealthReport()
+	service := report.Components[componentLinuxService]
+	if service.Healthy || report.Ready {
+		t.Errorf("linux_service = %+v, ready %v; want down after exit", service, report.Ready)
+	}
+	if _, ok := service.Info["down_since"]; !ok {
+		t.Errorf("info = %v, want down_since", service.Info)
+	}
+	if pid := c.GetLinuxServicePID(); pid != 0 {
+		t.Errorf("GetLinuxServicePID() = %d, want 0", pid)
+	}
+}
+
+// TestInterfaceAttachmentsConcurrentDetach 卸载与健康检查、状态报告并发读取挂载状态，配合 go test -race 运行
+func TestInterfaceAttachmentsConcurrentDetach(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c := &ContainerMonitor{attachMode: AttachModeTC, logger: logrus.NewEntry(logger)}
+	c.recordInterface(InterfaceStatus{Name: "eth0", Attached: true, Ingress: true, Mode: "tcx"},
+		&tcAttachment{interfaceName: "eth0", direction: DirectionClientToProxy},
+		&tcAttachment{interfaceName: "eth0", direction: DirectionProxyToClient})
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					c.interfaceAttachments()
+					c.HealthReport()
+					c.reportStatus()
+				}
+			}
+		}()
+	}
+	c.recordInterface(InterfaceStatus{Name: "eth1"})
+	c.detachEbpf()
+	close(done)
+	wg.Wait()
+
+	interfaces, attached := c.interfaceAttachments()
+	if attached != 0 || len(interfaces) != 2 {
+		t.Errorf("interfaceAttachments() = %v, %d; want both interfaces and no attachments after detach", interfaces, attached)
+	}
+}
@@ -0,0 +1,80 @@
+package interceptor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// InterfaceStatus 单个网络接口的挂载状态
+type InterfaceStatus struct {
+	Name     string
+	Attached bool   // egress 是否挂载成功
+	Ingress  bool   // ingress 是否挂载成功（捕获代理应答）
+	Mode     string // tcx / clsact
+	Err      error
+}
+
+// String 返回适合日志输出的状态描述
+func (s InterfaceStatus) String() string {
+	if s.Attached && s.Ingress {
+		return fmt.Sprintf("%s=%s(egress+ingress)", s.Name, s.Mode)
+	}
+	if s.Attached {
+		return fmt.Sprintf("%s=%s(egress, ingress失败: %v)", s.Name, s.Mode, s.Err)
+	}
+	return fmt.Sprintf("%s=failed(%v)", s.Name, s.Err)
+}
+
+// parseInterfaceNames 解析逗号分隔的接口列表，去除空白和重复项
+func parseInterfaceNames(value string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// detectDefaultRouteInterfaces 查找默认路由所在的网络接口
+func detectDefaultRouteInterfaces() ([]string, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("读取路由表失败: %w", err)
+	}
+
+	var names []string
+	seen := make(map[int]bool)
+	for _, route := range routes {
+		if !isDefaultRoute(route) || route.LinkIndex == 0 || seen[route.LinkIndex] {
+			continue
+		}
+		seen[route.LinkIndex] = true
+
+		link, err := netlink.LinkByIndex(route.LinkIndex)
+		if err != nil {
+			return nil, fmt.Errorf("查找默认路由接口失败 (index: %d): %w", route.LinkIndex, err)
+		}
+		names = append(names, link.Attrs().Name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("未找到默认路由接口")
+	}
+	return names, nil
+}
+
+// isDefaultRoute 判断是否为默认路由（0.0.0.0/0 或 ::/0）
+func isDefaultRoute(route netlink.Route) bool {
+	if route.Dst == nil {
+		return true
+	}
+	ones, _ := route.Dst.Mask.Size()
+	return ones == 0
+}
@@ -0,0 +1,244 @@
+package interceptor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsNamespace 指标名前缀
+const metricsNamespace = "wx_proxy"
+
+// metricsShutdownTimeout 退出时等待进行中的抓取完成的时间
+const metricsShutdownTimeout = 5 * time.Second
+
+// SetMetricsAddr 设置HTTP监控端点（/metrics、/healthz、/readyz）的监听地址（如 ":9100"），为空时不启动，需在 Start 之前调用
+func (c *ContainerMonitor) SetMetricsAddr(addr string) {
+	c.metricsAddr = addr
+}
+
+// startMetricsServer 启动HTTP监控端点，上下文取消后关闭
+func (c *ContainerMonitor) startMetricsServer(ctx context.Context) error {
+	addr, err := c.serveHTTP(ctx, c.metricsAddr, c.metricsHandler())
+	if err != nil {
+		return fmt.Errorf("监听监控端点失败 (%s): %w", c.metricsAddr, err)
+	}
+	c.logger.WithField("addr", addr.String()).Info("📈 监控端点已启动 (/metrics, /healthz, /readyz)")
+	return nil
+}
+
+// serveHTTP 在 addr 上启动HTTP服务，上下文取消后关闭，返回实际监听的地址
+func (c *ContainerMonitor) serveHTTP(ctx context.Context, addr string, handler http.Handler) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.WithError(err).WithField("addr", listener.Addr().String()).Error("❌ HTTP端点异常退出")
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// metricsHandler 监控端点的路由
+func (c *ContainerMonitor) metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.handleMetrics)
+	mux.HandleFunc("/healthz", c.handleHealthz)
+	mux.HandleFunc("/readyz", c.handleReadyz)
+	return mux
+}
+
+// handleMetrics 以 Prometheus 文本格式输出指标
+func (c *ContainerMonitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	c.WriteMetrics(buf)
+	buf.Flush()
+}
+
+// WriteMetrics 以 Prometheus 文本格式写出当前指标
+func (c *ContainerMonitor) WriteMetrics(w io.Writer) {
+	mw := &metricsWriter{w: w}
+
+	mw.family("uptime_seconds", "gauge", "监控器运行时间")
+	uptime := 0.0
+	if !c.startTime.IsZero() {
+		uptime = time.Since(c.startTime).Seconds()
+	}
+	mw.sample("uptime_seconds", nil, uptime)
+
+	mw.family("linux_service_up", "gauge", "linuxService 是否在运行")
+	mw.sample("linux_service_up", nil, boolMetric(c.linuxServiceRunning()))
+	mw.family("linux_service_restarts_total", "counter", "linuxService 异常退出后的自动重启次数")
+	mw.sample("linux_service_restarts_total", nil, float64(c.serviceRestarts.Load()))
+
+	if c.eventReader != nil {
+		stats := c.eventReader.Stats()
+		mw.family("events_received_total", "counter", "从 perf 缓冲区读取的eBPF事件")
+		mw.sample("events_received_total", nil, float64(stats.Received))
+		mw.family("events_lost_total", "counter", "perf 缓冲区溢出丢失的eBPF事件")
+		mw.sample("events_lost_total", nil, float64(stats.Lost))
+		mw.family("events_invalid_total", "counter", "无法解码的eBPF事件")
+		mw.sample("events_invalid_total", nil, float64(stats.Invalid))
+	}
+
+	monitor := c.socks5Monitor
+	if monitor == nil {
+		return
+	}
+
+	counts := monitor.SessionCounts()
+	mw.family("sessions", "gauge", "当前跟踪的SOCKS5会话数，按握手阶段")
+	for _, phase := range []SOCKS5Phase{PhaseGreeting, PhaseMethodSelection, PhaseSubNegotiation, PhaseRequest, PhaseReply, PhaseEstablished, PhaseFailed} {
+		mw.sample("sessions", []string{"state", string(phase)}, float64(counts[phase]))
+	}
+
+	reassembly := monitor.ReassemblyStats()
+	mw.family("tcp_retransmits_total", "counter", "重组时丢弃的TCP重传段")
+	mw.sample("tcp_retransmits_total", nil, float64(reassembly.Retransmits))
+	mw.family("tcp_gaps_total", "counter", "重组时无法补齐的TCP缺口")
+	mw.sample("tcp_gaps_total", nil, float64(reassembly.Gaps))
+
+	health := monitor.ProxyHealth()
+	mw.family("handshakes_total", "counter", "已结束的SOCKS5握手，按代理和结果")
+	for _, proxy := range health {
+		for _, outcome := range sortedKeys(proxy.Outcomes) {
+			mw.sample("handshakes_total", []string{"proxy", proxy.Proxy, "outcome", string(outcome)}, float64(proxy.Outcomes[outcome]))
+		}
+	}
+	mw.family("handshake_failures_total", "counter", "代理应答 REP 非零的握手，按代理和 REP")
+	for _, proxy := range health {
+		for _, code := range sortedKeys(proxy.ReplyCodes) {
+			if code.Succeeded() {
+				continue
+			}
+			mw.sample("handshake_failures_total", []string{"proxy", proxy.Proxy, "rep", code.String()}, float64(proxy.ReplyCodes[code]))
+		}
+	}
+	mw.family("proxy_unhealthy", "gauge", "代理在统计窗口内的失败率是否超过阈值")
+	for _, proxy := range health {
+		mw.sample("proxy_unhealthy", []string{"proxy", proxy.Proxy}, boolMetric(proxy.Unhealthy))
+	}
+
+	mw.family("tunnel_bytes_total", "counter", "握手之后经代理转发的TCP负载字节")
+	for _, traffic := range monitor.ProxyTraffic() {
+		mw.sample("tunnel_bytes_total", []string{"proxy", traffic.Proxy, "direction", "up"}, float64(traffic.BytesUp))
+		mw.sample("tunnel_bytes_total", []string{"proxy", traffic.Proxy, "direction", "down"}, float64(traffic.BytesDown))
+	}
+
+	mw.family("auth_reports_suppressed_total", "counter", "去重窗口内被合并的重复认证报告")
+	mw.sample("auth_reports_suppressed_total", nil, float64(monitor.SuppressedReports()))
+
+	// 监控端点没有认证，只按代理汇总，不暴露用户名
+	rotations := make(map[string]uint64)
+	for _, history := range monitor.CredentialHistory() {
+		rotations[history.Proxy] += history.Rotations
+	}
+	mw.family("credential_rotations_total", "counter", "观察到的凭据更换次数，按代理汇总")
+	for _, proxy := range sortedKeys(rotations) {
+		mw.sample("credential_rotations_total", []string{"proxy", proxy}, float64(rotations[proxy]))
+	}
+
+	histograms := monitor.ProxyLatencyHistograms()
+	mw.family("handshake_latency_seconds", "histogram", "SOCKS5握手各阶段耗时，按代理和阶段")
+	for _, proxy := range sortedKeys(histograms) {
+		for _, metric := range latencyMetrics {
+			h, ok := histograms[proxy][metric]
+			if !ok {
+				continue
+			}
+			labels := []string{"proxy", proxy, "stage", string(metric)}
+			for i, bound := range h.Bounds {
+				mw.sample("handshake_latency_seconds_bucket", append(labels, "le", strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)), float64(h.Counts[i]))
+			}
+			mw.sample("handshake_latency_seconds_bucket", append(labels, "le", "+Inf"), float64(h.Count))
+			mw.sample("handshake_latency_seconds_sum", labels, h.Sum.Seconds())
+			mw.sample("handshake_latency_seconds_count", labels, float64(h.Count))
+		}
+	}
+}
+
+// linuxServiceRunning linuxService 进程是否在运行
+func (c *ContainerMonitor) linuxServiceRunning() bool {
+	return c.linuxServicePID.Load() > 0
+}
+
+// metricsWriter 输出 Prometheus 文本格式，记录第一个写入错误
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+// family 输出指标说明和类型
+func (mw *metricsWriter) family(name, typ, help string) {
+	mw.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", metricsNamespace, name, help, metricsNamespace, name, typ)
+}
+
+// sample 输出一个样本，labels 为交替的名称和值
+func (mw *metricsWriter) sample(name string, labels []string, value float64) {
+	var b strings.Builder
+	b.WriteString(metricsNamespace + "_" + name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	mw.printf("%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// printf 写出一行，出错后不再继续写
+func (mw *metricsWriter) printf(format string, args ...any) {
+	if mw.err != nil {
+		return
+	}
+	_, mw.err = fmt.Fprintf(mw.w, format, args...)
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// boolMetric 将布尔值转换为 0/1
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortedKeys 返回排序后的映射键，保证输出顺序稳定
+func sortedKeys[K ~string | ~byte, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
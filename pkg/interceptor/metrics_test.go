@@ -0,0 +1,183 @@
+package interceptor
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// handshake 通过 AnalyzePacket 完成一次用户名密码握手，rep 为代理应答码
+func handshake(m *EnhancedSOCKS5Monitor, client string, port uint16, username, password string, rep byte) {
+	const proxy = "10.0.0.9"
+	auth := append([]byte{1, byte(len(username))}, username...)
+	auth = append(auth, byte(len(password)))
+	auth = append(auth, password...)
+	m.AnalyzePacket(DirectionClientToProxy, []byte{5, 1, 2}, client, proxy, port, 1080)
+	m.AnalyzePacket(DirectionProxyToClient, []byte{5, 2}, proxy, client, 1080, port)
+	m.AnalyzePacket(DirectionClientToProxy, auth, client, proxy, port, 1080)
+	m.AnalyzePacket(DirectionProxyToClient, []byte{1, 0}, proxy, client, 1080, port)
+	m.AnalyzePacket(DirectionClientToProxy, []byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80}, client, proxy, port, 1080)
+	m.AnalyzePacket(DirectionProxyToClient, []byte{5, rep, 0, 1, 1, 2, 3, 4, 0, 80}, proxy, client, 1080, port)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := newTestMonitor()
+	m.SetFlowStatsSource(func(session *SOCKS5Session) (FlowCounters, bool) {
+		if session.ClientPort != 40001 {
+			return FlowCounters{}, false
+		}
+		return FlowCounters{BytesUp: 1200, BytesDown: 3400, PacketsUp: 3, PacketsDown: 4}, true
+	})
+	handshake(m, "10.0.1.1", 40001, "alice", "secret1", 0x00)
+	handshake(m, "10.0.1.1", 40002, "alice", "secret2", 0x05)
+	handshake(m, "10.0.1.1", 40003, "bob", "hunter2", 0x00)
+	// 内核事件带时间戳，产生握手时延样本：方法选择 2ms，CONNECT 20ms
+	for _, seg := range []struct {
+		dir     Direction
+		seq     uint32
+		ts      uint64
+		payload []byte
+	}{
+		{DirectionClientToProxy, 1000, 1_000_000, []byte{5, 1, 0}},
+		{DirectionProxyToClient, 5000, 3_000_000, []byte{5, 0}},
+		{DirectionClientToProxy, 1003, 4_000_000, []byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80}},
+		{DirectionProxyToClient, 5002, 24_000_000, []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}},
+	} {
+		event := &SOCKS5AuthEvent{Type: SOCKS5EventSegment, Direction: seg.dir, SrcIP: net.ParseIP("10.0.1.2"), DstIP: net.ParseIP("10.0.0.9"),
+			SrcPort: 40004, DstPort: 1080, Seq: seg.seq, SegLen: uint32(len(seg.payload)), Payload: seg.payload, Timestamp: seg.ts}
+		if seg.dir == DirectionProxyToClient {
+			event.SrcIP, event.DstIP = event.DstIP, event.SrcIP
+			event.SrcPort, event.DstPort = event.DstPort, event.SrcPort
+		}
+		m.HandleAuthEvent(event)
+	}
+	m.CleanupSessions()
+
+	c := &ContainerMonitor{socks5Monitor: m}
+	c.serviceRestarts.Store(2)
+	server := httptest.NewServer(c.metricsHandler())
+	defer server.Close()
+
+	// 凭据历史不在监控端点上暴露
+	if resp, err := http.Get(server.URL + "/credentials"); err != nil {
+		t.Fatalf("GET /credentials: %v", err)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET /credentials on metrics listener: status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	samples := make(map[string]string)
+	families := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			families[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		samples[line[:i]] = line[i+1:]
+	}
+
+	wantFamilies := map[string]string{
+		"wx_proxy_uptime_seconds":                "gauge",
+		"wx_proxy_linux_service_up":              "gauge",
+		"wx_proxy_linux_service_restarts_total":  "counter",
+		"wx_proxy_sessions":                      "gauge",
+		"wx_proxy_tcp_retransmits_total":         "counter",
+		"wx_proxy_tcp_gaps_total":                "counter",
+		"wx_proxy_handshakes_total":              "counter",
+		"wx_proxy_handshake_failures_total":      "counter",
+		"wx_proxy_proxy_unhealthy":               "gauge",
+		"wx_proxy_tunnel_bytes_total":            "counter",
+		"wx_proxy_auth_reports_suppressed_total": "counter",
+		"wx_proxy_credential_rotations_total":    "counter",
+		"wx_proxy_handshake_latency_seconds":     "histogram",
+	}
+	for name, typ := range wantFamilies {
+		if got := families[name]; got != typ {
+			t.Errorf("# TYPE %s = %q, want %q", name, got, typ)
+		}
+	}
+	// 未启动 eBPF 读取器时不输出事件计数
+	if _, ok := families["wx_proxy_events_received_total"]; ok {
+		t.Error("events_received_total exported without an event reader")
+	}
+
+	const proxy = `proxy="10.0.0.9:1080"`
+	wantSamples := []struct {
+		sample string
+		value  string
+	}{
+		{"wx_proxy_linux_service_up", "0"},
+		{"wx_proxy_linux_service_restarts_total", "2"},
+		{`wx_proxy_sessions{state="established"}`, "3"},
+		{`wx_proxy_sessions{state="failed"}`, "1"},
+		{`wx_proxy_sessions{state="greeting"}`, "0"},
+		{"wx_proxy_tcp_retransmits_total", "0"},
+		{"wx_proxy_tcp_gaps_total", "0"},
+		{`wx_proxy_handshakes_total{` + proxy + `,outcome="success"}`, "3"},
+		{`wx_proxy_handshakes_total{` + proxy + `,outcome="reply_error"}`, "1"},
+		{`wx_proxy_handshake_failures_total{` + proxy + `,rep="` + SOCKS5ReplyCode(0x05).String() + `"}`, "1"},
+		{`wx_proxy_proxy_unhealthy{` + proxy + `}`, "0"},
+		{`wx_proxy_tunnel_bytes_total{` + proxy + `,direction="up"}`, "1200"},
+		{`wx_proxy_tunnel_bytes_total{` + proxy + `,direction="down"}`, "3400"},
+		{"wx_proxy_auth_reports_suppressed_total", "0"},
+		{`wx_proxy_credential_rotations_total{` + proxy + `}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="method",le="0.001"}`, "0"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="method",le="0.005"}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="method",le="+Inf"}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_sum{` + proxy + `,stage="method"}`, "0.002"},
+		{`wx_proxy_handshake_latency_seconds_count{` + proxy + `,stage="method"}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="connect",le="0.01"}`, "0"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="connect",le="0.025"}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_bucket{` + proxy + `,stage="connect",le="10"}`, "1"},
+		{`wx_proxy_handshake_latency_seconds_sum{` + proxy + `,stage="connect"}`, "0.02"},
+		{`wx_proxy_handshake_latency_seconds_count{` + proxy + `,stage="connect"}`, "1"},
+	}
+	for _, w := range wantSamples {
+		got, ok := samples[w.sample]
+		if !ok {
+			t.Errorf("missing sample %s", w.sample)
+			continue
+		}
+		if got != w.value {
+			t.Errorf("%s = %s, want %s", w.sample, got, w.value)
+		}
+	}
+	// 未认证的监控端点不暴露用户名
+	for _, username := range []string{"alice", "bob"} {
+		if strings.Contains(string(body), username) {
+			t.Errorf("metrics expose username %q", username)
+		}
+	}
+	if t.Failed() {
+		t.Logf("scraped metrics:\n%s", body)
+	}
+}
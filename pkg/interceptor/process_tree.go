@@ -0,0 +1,172 @@
+package interceptor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// processTreePrograms 维护 supervised_tgids 的调度器跟踪点程序
+type processTreePrograms struct {
+	TraceProcessFork *ebpf.Program `ebpf:"trace_process_fork"`
+	TraceProcessExec *ebpf.Program `ebpf:"trace_process_exec"`
+	TraceProcessExit *ebpf.Program `ebpf:"trace_process_exit"`
+}
+
+// processTree 受监控进程树的跟踪程序及其挂载状态
+// fork 时子进程继承父进程的监控资格，exit 时移除，TC只上报进程树内socket发出的报文
+type processTree struct {
+	processTreePrograms
+	links []link.Link
+	err   error // 加载或挂载失败的原因，非空时不按进程过滤
+}
+
+// loadProcessTree 加载跟踪点程序，复用已创建的共享映射
+func loadProcessTree(spec *ebpf.CollectionSpec, opts *ebpf.CollectionOptions) (*processTree, error) {
+	tree := &processTree{}
+	if err := spec.LoadAndAssign(&tree.processTreePrograms, opts); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Attach 挂载 sched_process_fork/exec/exit 跟踪点，全部成功才视为可用
+func (t *processTree) Attach() error {
+	if t.err != nil {
+		return t.err
+	}
+
+	tracepoints := []struct {
+		name string
+		prog *ebpf.Program
+	}{
+		{"sched_process_fork", t.TraceProcessFork},
+		{"sched_process_exec", t.TraceProcessExec},
+		{"sched_process_exit", t.TraceProcessExit},
+	}
+	for _, tp := range tracepoints {
+		l, err := link.Tracepoint("sched", tp.name, tp.prog, nil)
+		if err != nil {
+			t.err = &EbpfError{Stage: EbpfStageAttach, Program: "sched/" + tp.name, Err: err}
+			t.closeLinks()
+			return t.err
+		}
+		t.links = append(t.links, l)
+	}
+	return nil
+}
+
+// Available 跟踪点是否已挂载
+func (t *processTree) Available() bool {
+	return t != nil && t.err == nil && len(t.links) > 0
+}
+
+// closeLinks 卸载已挂载的跟踪点
+func (t *processTree) closeLinks() error {
+	var errs []error
+	for i := len(t.links) - 1; i >= 0; i-- {
+		if err := t.links[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.links = nil
+	return errors.Join(errs...)
+}
+
+// Close 卸载并释放程序
+func (t *processTree) Close() error {
+	errs := []error{t.closeLinks()}
+	for _, prog := range []*ebpf.Program{t.TraceProcessFork, t.TraceProcessExec, t.TraceProcessExit} {
+		if prog == nil {
+			continue
+		}
+		if err := prog.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setSupervisedProcess 以 root 为根重建受监控进程树，root 为0时关闭过滤
+// 先写入新进程树再删除不属于它的 TGID（包括被重新挂到init下的孤儿进程），更新期间新进程不会漏报
+func (o *ebpfObjects) setSupervisedProcess(root int) error {
+	keep := make(map[uint32]bool)
+	if root > 0 {
+		// 跟踪点挂载前已经创建的子进程从 /proc 补齐
+		for _, pid := range processDescendants(root) {
+			if err := o.Supervised.Put(uint32(pid), uint8(1)); err != nil {
+				return fmt.Errorf("写入 supervised_tgids 失败 (PID: %d): %w", pid, err)
+			}
+			keep[uint32(pid)] = true
+		}
+	}
+
+	if err := o.Filter.Put(uint32(0), uint32(root)); err != nil {
+		return fmt.Errorf("写入 process_filter 失败: %w", err)
+	}
+
+	var key uint32
+	var stale []uint32
+	var present uint8
+	iter := o.Supervised.Iterate()
+	for iter.Next(&key, &present) {
+		if !keep[key] {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("遍历 supervised_tgids 失败: %w", err)
+	}
+	for _, key := range stale {
+		if err := o.Supervised.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("删除 supervised_tgids 失败 (PID: %d): %w", key, err)
+		}
+	}
+	return nil
+}
+
+// processDescendants 返回 root 及其所有子孙进程，读取 /proc/<pid>/stat 中的父进程号
+func processDescendants(root int) []int {
+	pids := []int{root}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return pids
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// 格式: pid (comm) state ppid ...，comm 可能包含空格和括号
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+	return pids
+}
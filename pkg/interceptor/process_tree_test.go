@@ -0,0 +1,87 @@
+package interceptor
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// newProcessTreeMaps 创建与 supervised_tgids / process_filter 结构相同的映射，没有权限时跳过
+func newProcessTreeMaps(t *testing.T) *ebpfObjects {
+	t.Helper()
+	supervised, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 1, MaxEntries: 4096})
+	if err != nil {
+		t.Skipf("无法创建eBPF映射: %v", err)
+	}
+	t.Cleanup(func() { supervised.Close() })
+	filter, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: 4, MaxEntries: 1})
+	if err != nil {
+		t.Skipf("无法创建eBPF映射: %v", err)
+	}
+	t.Cleanup(func() { filter.Close() })
+	return &ebpfObjects{ebpfMaps: ebpfMaps{Supervised: supervised, Filter: filter}}
+}
+
+// supervisedKeys 返回映射中的全部 TGID
+func supervisedKeys(t *testing.T, m *ebpf.Map) []uint32 {
+	t.Helper()
+	var key uint32
+	var present uint8
+	var keys []uint32
+	iter := m.Iterate()
+	for iter.Next(&key, &present) {
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func TestSetSupervisedProcess(t *testing.T) {
+	objs := newProcessTreeMaps(t)
+	root := uint32(os.Getpid())
+	const stale = 0x7ffffff0 // 旧进程树中已不存在的进程
+
+	// 新进程树的根已经在映射中（例如由fork跟踪点加入），旧条目需要被移除
+	for _, pid := range []uint32{root, stale} {
+		if err := objs.Supervised.Put(pid, uint8(1)); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+
+	if err := objs.setSupervisedProcess(int(root)); err != nil {
+		t.Fatalf("setSupervisedProcess(%d): %v", root, err)
+	}
+	want := make(map[uint32]bool)
+	for _, pid := range processDescendants(int(root)) {
+		want[uint32(pid)] = true
+	}
+	keys := supervisedKeys(t, objs.Supervised)
+	if len(keys) != len(want) {
+		t.Errorf("supervised_tgids = %v, want %d entries", keys, len(want))
+	}
+	for _, key := range keys {
+		if !want[key] {
+			t.Errorf("supervised_tgids contains stale TGID %d", key)
+		}
+	}
+	var filter uint32
+	if err := objs.Filter.Lookup(uint32(0), &filter); err != nil || filter != root {
+		t.Errorf("process_filter = %d (%v), want %d", filter, err, root)
+	}
+
+	// 根为0时关闭过滤并清空进程树
+	if err := objs.setSupervisedProcess(0); err != nil {
+		t.Fatalf("setSupervisedProcess(0): %v", err)
+	}
+	if keys := supervisedKeys(t, objs.Supervised); len(keys) != 0 {
+		t.Errorf("supervised_tgids = %v, want empty", keys)
+	}
+	if err := objs.Filter.Lookup(uint32(0), &filter); err != nil || filter != 0 {
+		t.Errorf("process_filter = %d (%v), want 0", filter, err)
+	}
+}
@@ -0,0 +1,312 @@
+package interceptor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// HandshakeOutcome 握手结果分类
+type HandshakeOutcome string
+
+const (
+	OutcomeSuccess        HandshakeOutcome = "success"         // 握手完成
+	OutcomeAuthFailure    HandshakeOutcome = "auth_failure"    // 代理拒绝用户名密码
+	OutcomeReplyError     HandshakeOutcome = "reply_error"     // 代理应答 REP 非零
+	OutcomeMethodRejected HandshakeOutcome = "method_rejected" // 代理拒绝或选择了不支持的认证方法
+	OutcomeClosed         HandshakeOutcome = "closed"          // 握手完成前连接被关闭
+	OutcomeTimeout        HandshakeOutcome = "timeout"         // 握手完成前连接长时间无数据
+	OutcomeProtocolError  HandshakeOutcome = "protocol_error"  // 报文不符合协议或数据流缺口
+	OutcomeBufferOverflow HandshakeOutcome = "buffer_overflow" // 未解析的握手数据超出缓冲区上限
+)
+
+// maxHealthWindowSamples 每个代理统计窗口内保留的结果数上限，超出后丢弃最旧的
+const maxHealthWindowSamples = 4096
+
+// ProxyHealthConfig 代理健康告警配置
+type ProxyHealthConfig struct {
+	Window           time.Duration // 失败率统计窗口
+	FailureThreshold float64       // 窗口内失败率达到该值时告警，取值 (0, 1]
+	MinSessions      int           // 窗口内会话数少于该值时不判定，避免样本过少误报
+}
+
+// DefaultProxyHealthConfig 默认配置：5分钟内至少5个会话且失败率达到50%时告警
+func DefaultProxyHealthConfig() ProxyHealthConfig {
+	return ProxyHealthConfig{
+		Window:           5 * time.Minute,
+		FailureThreshold: 0.5,
+		MinSessions:      5,
+	}
+}
+
+// Validate 检查配置取值
+func (c ProxyHealthConfig) Validate() error {
+	if c.Window <= 0 {
+		return fmt.Errorf("代理健康统计窗口必须大于0: %s", c.Window)
+	}
+	if c.FailureThreshold <= 0 || c.FailureThreshold > 1 {
+		return fmt.Errorf("代理失败率阈值必须在 (0, 1] 之间: %g", c.FailureThreshold)
+	}
+	if c.MinSessions < 1 {
+		return fmt.Errorf("代理健康判定的最少会话数必须大于0: %d", c.MinSessions)
+	}
+	return nil
+}
+
+// ProxyHealthAlert 代理健康状态变化：窗口内失败率越过阈值或恢复
+type ProxyHealthAlert struct {
+	Proxy       string
+	Unhealthy   bool // true 为进入告警，false 为恢复
+	FailureRate float64
+	Sessions    int // 窗口内会话数
+	Failures    int // 窗口内失败数
+	Outcomes    map[HandshakeOutcome]int
+	Window      time.Duration
+	Threshold   float64
+}
+
+// ProxyHealthAlertHandler 接收代理健康状态变化，在分片锁和 healthMu 释放后调用，可以回调监控器
+type ProxyHealthAlertHandler func(alert ProxyHealthAlert)
+
+// SetProxyHealthConfig 设置代理健康告警配置
+func (m *EnhancedSOCKS5Monitor) SetProxyHealthConfig(config ProxyHealthConfig) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	m.healthConfig = config
+}
+
+// SetProxyHealthAlertHandler 设置代理健康告警的接收者，为 nil 时只写日志
+func (m *EnhancedSOCKS5Monitor) SetProxyHealthAlertHandler(handler ProxyHealthAlertHandler) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	m.healthAlert = handler
+}
+
+// classifyOutcome 根据终止状态判断握手结果
+func classifyOutcome(session *SOCKS5Session) HandshakeOutcome {
+	switch {
+	case session.Phase == PhaseEstablished:
+		return OutcomeSuccess
+	case session.AuthResult == AuthResultFailure:
+		return OutcomeAuthFailure
+	case session.Reply != nil && !session.Reply.Code.Succeeded():
+		return OutcomeReplyError
+	case session.MethodObserved && session.SelectedMethod != socks5MethodNoAuth && session.SelectedMethod != socks5MethodUserPass:
+		return OutcomeMethodRejected
+	default:
+		return OutcomeProtocolError
+	}
+}
+
+// finishHandshake 记录会话的握手结果，每个会话只记录一次（调用方需持有分片锁）
+// 健康状态变化产生的告警暂存在分片上，由 unlockShard 在释放分片锁后发送
+func (m *EnhancedSOCKS5Monitor) finishHandshake(conn *socks5Conn, outcome HandshakeOutcome) {
+	session := conn.session
+	if session.Outcome != "" {
+		return
+	}
+	session.Outcome = outcome
+
+	// 凭据被截断且后续字节始终没有到达：不记录不完整的凭据，标记为凭据不完整
+	if !conn.authSent && session.Truncated&(TruncatedUsername|TruncatedPassword) != 0 {
+		session.AuthResult = AuthResultIncomplete
+		session.Status = "凭据不完整"
+		log.Printf("⚠️ [SOCKS5-密码认证] 会话 %s 凭据跨越多个数据包且未能补齐 (%s)，不记录凭据", session.SessionID, session.Truncated)
+	}
+	if alert, changed := m.recordOutcome(session, time.Now()); changed {
+		shard := m.shardFor(session.SessionID)
+		shard.alerts = append(shard.alerts, alert)
+	}
+}
+
+// unlockShard 释放分片锁，再发送锁内产生的代理健康告警
+func (m *EnhancedSOCKS5Monitor) unlockShard(shard *sessionShard) {
+	alerts := shard.alerts
+	shard.alerts = nil
+	shard.mu.Unlock()
+	if len(alerts) == 0 {
+		return
+	}
+
+	m.healthMu.Lock()
+	handler := m.healthAlert
+	m.healthMu.Unlock()
+	for _, alert := range alerts {
+		emitProxyHealthAlert(handler, alert)
+	}
+}
+
+// healthOutcome 窗口内的一个握手结果
+type healthOutcome struct {
+	at      time.Time
+	outcome HandshakeOutcome
+}
+
+// proxyHealth 单个代理的累计结果和窗口
+type proxyHealth struct {
+	outcomes   map[HandshakeOutcome]uint64
+	replyCodes map[SOCKS5ReplyCode]uint64
+	window     []healthOutcome
+	unhealthy  bool
+}
+
+// recordOutcome 累计结果并重新评估所属代理的健康状态，返回状态是否发生变化
+func (m *EnhancedSOCKS5Monitor) recordOutcome(session *SOCKS5Session, now time.Time) (ProxyHealthAlert, bool) {
+	proxy := joinHostPort(session.ProxyIP, session.ProxyPort)
+
+	m.healthMu.Lock()
+	if m.health == nil {
+		m.health = make(map[string]*proxyHealth)
+	}
+	health, ok := m.health[proxy]
+	if !ok {
+		health = &proxyHealth{
+			outcomes:   make(map[HandshakeOutcome]uint64),
+			replyCodes: make(map[SOCKS5ReplyCode]uint64),
+		}
+		m.health[proxy] = health
+	}
+	health.outcomes[session.Outcome]++
+	if session.Reply != nil {
+		health.replyCodes[session.Reply.Code]++
+	}
+	health.window = append(health.window, healthOutcome{at: now, outcome: session.Outcome})
+	if len(health.window) > maxHealthWindowSamples {
+		health.window = health.window[len(health.window)-maxHealthWindowSamples:]
+	}
+	alert, changed := m.evaluateProxyHealth(proxy, health, now)
+	m.healthMu.Unlock()
+	return alert, changed
+}
+
+// EvaluateProxyHealth 清理过期的窗口结果并重新评估所有代理，没有新会话的代理也能恢复
+func (m *EnhancedSOCKS5Monitor) EvaluateProxyHealth() {
+	now := time.Now()
+
+	m.healthMu.Lock()
+	var alerts []ProxyHealthAlert
+	for proxy, health := range m.health {
+		if alert, changed := m.evaluateProxyHealth(proxy, health, now); changed {
+			alerts = append(alerts, alert)
+		}
+	}
+	handler := m.healthAlert
+	m.healthMu.Unlock()
+
+	for _, alert := range alerts {
+		emitProxyHealthAlert(handler, alert)
+	}
+}
+
+// evaluateProxyHealth 清理过期的窗口结果并更新健康状态，返回状态是否发生变化（调用方需持有 healthMu）
+func (m *EnhancedSOCKS5Monitor) evaluateProxyHealth(proxy string, health *proxyHealth, now time.Time) (ProxyHealthAlert, bool) {
+	alert, start := m.healthWindow(proxy, health, now)
+	health.window = health.window[start:]
+
+	if alert.Unhealthy == health.unhealthy {
+		return alert, false
+	}
+	health.unhealthy = alert.Unhealthy
+	return alert, true
+}
+
+// healthWindow 计算窗口内失败率，不修改状态；start 为窗口内第一个结果的下标（调用方需持有 healthMu）
+func (m *EnhancedSOCKS5Monitor) healthWindow(proxy string, health *proxyHealth, now time.Time) (alert ProxyHealthAlert, start int) {
+	config := m.healthConfig
+	if config.Window <= 0 {
+		config = DefaultProxyHealthConfig()
+	}
+
+	cutoff := now.Add(-config.Window)
+	start = sort.Search(len(health.window), func(i int) bool { return health.window[i].at.After(cutoff) })
+	window := health.window[start:]
+
+	alert = ProxyHealthAlert{
+		Proxy:     proxy,
+		Sessions:  len(window),
+		Outcomes:  make(map[HandshakeOutcome]int),
+		Window:    config.Window,
+		Threshold: config.FailureThreshold,
+	}
+	for _, o := range window {
+		alert.Outcomes[o.outcome]++
+		if o.outcome != OutcomeSuccess {
+			alert.Failures++
+		}
+	}
+	if alert.Sessions > 0 {
+		alert.FailureRate = float64(alert.Failures) / float64(alert.Sessions)
+	}
+
+	// 已告警的代理在失败率回落或窗口内样本不足（例如不再有新连接）时恢复
+	alert.Unhealthy = alert.Sessions >= config.MinSessions && alert.FailureRate >= config.FailureThreshold
+	return alert, start
+}
+
+// emitProxyHealthAlert 通知接收者，未设置时写日志
+func emitProxyHealthAlert(handler ProxyHealthAlertHandler, alert ProxyHealthAlert) {
+	if handler != nil {
+		handler(alert)
+		return
+	}
+	if alert.Unhealthy {
+		log.Printf("🚨 [SOCKS5-代理健康] %s 失败率 %.0f%% (%d/%d, 窗口 %s)", alert.Proxy, alert.FailureRate*100, alert.Failures, alert.Sessions, alert.Window)
+	} else {
+		log.Printf("✅ [SOCKS5-代理健康] %s 已恢复，失败率 %.0f%% (%d/%d)", alert.Proxy, alert.FailureRate*100, alert.Failures, alert.Sessions)
+	}
+}
+
+// ProxyHealth 单个上游代理的健康汇总
+type ProxyHealth struct {
+	Proxy        string
+	Successes    uint64
+	Failures     uint64
+	AuthFailures uint64
+	Outcomes     map[HandshakeOutcome]uint64 // 累计结果分布
+	ReplyCodes   map[SOCKS5ReplyCode]uint64  // 观察到的 REP 分布（含成功）
+	Window       ProxyHealthAlert            // 当前窗口的统计
+	Unhealthy    bool
+	Latency      map[LatencyMetric]LatencyPercentiles
+}
+
+// ProxyHealth 返回每个上游代理的健康汇总，按代理排序
+// 只读取状态，不清理窗口也不触发告警；Unhealthy 为最近一次评估（EvaluateProxyHealth 或新结果）的结论
+func (m *EnhancedSOCKS5Monitor) ProxyHealth() []ProxyHealth {
+	latency := make(map[string]map[LatencyMetric]LatencyPercentiles)
+	for _, proxy := range m.ProxyLatency() {
+		latency[proxy.Proxy] = proxy.Metrics
+	}
+
+	now := time.Now()
+	m.healthMu.Lock()
+	result := make([]ProxyHealth, 0, len(m.health))
+	for proxy, health := range m.health {
+		window, _ := m.healthWindow(proxy, health, now)
+		summary := ProxyHealth{
+			Proxy:      proxy,
+			Outcomes:   make(map[HandshakeOutcome]uint64, len(health.outcomes)),
+			ReplyCodes: make(map[SOCKS5ReplyCode]uint64, len(health.replyCodes)),
+			Window:     window,
+			Unhealthy:  health.unhealthy,
+			Latency:    latency[proxy],
+		}
+		for outcome, n := range health.outcomes {
+			summary.Outcomes[outcome] = n
+			if outcome == OutcomeSuccess {
+				summary.Successes += n
+			} else {
+				summary.Failures += n
+			}
+		}
+		summary.AuthFailures = health.outcomes[OutcomeAuthFailure]
+		for code, n := range health.replyCodes {
+			summary.ReplyCodes[code] = n
+		}
+		result = append(result, summary)
+	}
+	m.healthMu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Proxy < result[j].Proxy })
+	return result
+}
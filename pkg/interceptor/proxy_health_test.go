@@ -0,0 +1,89 @@
+package interceptor
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestProxyHealthReadOnly ProxyHealth 只读取状态，窗口过期后的恢复只由 EvaluateProxyHealth 判定和告警
+func TestProxyHealthReadOnly(t *testing.T) {
+	const window = 20 * time.Millisecond
+	m := newTestMonitor()
+	m.SetProxyHealthConfig(ProxyHealthConfig{Window: window, FailureThreshold: 0.5, MinSessions: 1})
+
+	var mu sync.Mutex
+	var alerts []ProxyHealthAlert
+	m.SetProxyHealthAlertHandler(func(alert ProxyHealthAlert) {
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, alert)
+	})
+	alertCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(alerts)
+	}
+
+	handshake(m, "10.0.1.1", 40001, "alice", "secret", byte(ReplyConnectionRefused))
+	if n := alertCount(); n != 1 || !alerts[0].Unhealthy {
+		t.Fatalf("alerts = %+v, want one unhealthy alert", alerts)
+	}
+
+	health := m.ProxyHealth()
+	if len(health) != 1 || !health[0].Unhealthy || health[0].Window.Sessions != 1 {
+		t.Fatalf("ProxyHealth() = %+v, want unhealthy with 1 session in window", health)
+	}
+
+	// 窗口过期后多次读取：窗口统计为空，但状态不变、不告警
+	time.Sleep(2 * window)
+	for i := 0; i < 3; i++ {
+		health = m.ProxyHealth()
+		if !health[0].Unhealthy || health[0].Window.Sessions != 0 || health[0].Window.Unhealthy {
+			t.Fatalf("ProxyHealth() #%d = %+v, want previous unhealthy state with empty window", i, health[0])
+		}
+	}
+	if n := alertCount(); n != 1 {
+		t.Fatalf("ProxyHealth() emitted alerts: %+v", alerts)
+	}
+
+	m.EvaluateProxyHealth()
+	if n := alertCount(); n != 2 || alerts[1].Unhealthy {
+		t.Fatalf("alerts = %+v, want recovery alert from EvaluateProxyHealth", alerts)
+	}
+	if health = m.ProxyHealth(); health[0].Unhealthy {
+		t.Errorf("ProxyHealth() = %+v, want healthy after evaluation", health[0])
+	}
+	if health[0].Failures != 1 || health[0].Outcomes[OutcomeReplyError] != 1 {
+		t.Errorf("cumulative outcomes = %+v, want 1 reply_error", health[0].Outcomes)
+	}
+}
+
+// TestProxyHealthAlertOutsideLock 告警接收者回调监控器时不会死锁
+func TestProxyHealthAlertOutsideLock(t *testing.T) {
+	m := newTestMonitor()
+	m.SetProxyHealthConfig(ProxyHealthConfig{Window: time.Minute, FailureThreshold: 0.5, MinSessions: 1})
+
+	var alerts []ProxyHealthAlert
+	m.SetProxyHealthAlertHandler(func(alert ProxyHealthAlert) {
+		// 同一分片上的会话、健康状态和处理器设置都需要加锁
+		m.Sessions()
+		m.ProxyHealth()
+		m.SetProxyHealthConfig(ProxyHealthConfig{Window: time.Minute, FailureThreshold: 0.5, MinSessions: 1})
+		alerts = append(alerts, alert)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handshake(m, "10.0.1.1", 40001, "alice", "secret", byte(ReplyConnectionRefused))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake deadlocked while the alert handler called back into the monitor")
+	}
+	if len(alerts) != 1 || !alerts[0].Unhealthy || alerts[0].Proxy != "10.0.0.9:1080" {
+		t.Errorf("alerts = %+v, want one unhealthy alert for 10.0.0.9:1080", alerts)
+	}
+}
@@ -0,0 +1,258 @@
+package interceptor
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// DefaultSOCKSPorts 默认的SOCKS5代理端口
+const DefaultSOCKSPorts = "1080,1081,7890,7891,8080,8081,9050,9051"
+
+// 内核映射容量（与 socks5_ports、socks5_proxies 的 max_entries 一致）
+const (
+	maxProxyPorts     = 64
+	maxProxyEndpoints = 256
+)
+
+// ProxyTargets 需要监控的SOCKS5代理集合：任意地址上的端口，或指定的 IP:端口
+// 创建后不可修改，运行时更新通过替换整个集合完成
+type ProxyTargets struct {
+	ports     map[uint16]struct{}
+	endpoints map[netip.AddrPort]struct{}
+}
+
+// ParseProxyTargets 解析逗号分隔的代理配置
+// ports 形如 "1080,7890"，endpoints 形如 "10.0.0.1:1080,[2001:db8::1]:1080"
+func ParseProxyTargets(ports, endpoints string) (*ProxyTargets, error) {
+	t := newProxyTargets()
+
+	for _, item := range strings.Split(ports, ",") {
+		if err := t.addPort(strings.TrimSpace(item)); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range strings.Split(endpoints, ",") {
+		if err := t.addEndpoint(strings.TrimSpace(item)); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.validate()
+}
+
+// ParseProxyTargetList 解析混合列表，项之间以逗号、空白或换行分隔，# 之后为注释
+// 纯数字视为端口，其余视为 IP:端口，适用于配置文件
+func ParseProxyTargetList(list string) (*ProxyTargets, error) {
+	t := newProxyTargets()
+
+	for _, line := range strings.Split(list, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, item := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			var err error
+			if _, convErr := strconv.Atoi(item); convErr == nil {
+				err = t.addPort(item)
+			} else {
+				err = t.addEndpoint(item)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t.validate()
+}
+
+// newProxyTargets 创建空集合
+func newProxyTargets() *ProxyTargets {
+	return &ProxyTargets{
+		ports:     make(map[uint16]struct{}),
+		endpoints: make(map[netip.AddrPort]struct{}),
+	}
+}
+
+// addPort 添加端口，空项忽略
+func (t *ProxyTargets) addPort(item string) error {
+	if item == "" {
+		return nil
+	}
+	port, err := strconv.ParseUint(item, 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("无效的SOCKS端口: %q", item)
+	}
+	t.ports[uint16(port)] = struct{}{}
+	return nil
+}
+
+// addEndpoint 添加 IP:端口，空项忽略
+func (t *ProxyTargets) addEndpoint(item string) error {
+	if item == "" {
+		return nil
+	}
+	endpoint, err := netip.ParseAddrPort(item)
+	if err != nil || endpoint.Port() == 0 {
+		return fmt.Errorf("无效的代理地址: %q", item)
+	}
+	t.endpoints[normalizeAddrPort(endpoint)] = struct{}{}
+	return nil
+}
+
+// validate 检查集合非空
+func (t *ProxyTargets) validate() (*ProxyTargets, error) {
+	if len(t.ports) == 0 && len(t.endpoints) == 0 {
+		return nil, fmt.Errorf("代理端口和代理地址不能同时为空")
+	}
+	if len(t.ports) > maxProxyPorts || len(t.endpoints) > maxProxyEndpoints {
+		return nil, fmt.Errorf("代理集合超出内核映射容量 (端口 ≤ %d, 地址 ≤ %d)", maxProxyPorts, maxProxyEndpoints)
+	}
+	return t, nil
+}
+
+// DefaultProxyTargets 返回默认端口集合
+func DefaultProxyTargets() *ProxyTargets {
+	t, err := ParseProxyTargets(DefaultSOCKSPorts, "")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// normalizeAddrPort 统一去掉IPv4映射和IPv6 zone，保证与内核侧键一致
+func normalizeAddrPort(endpoint netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(endpoint.Addr().Unmap().WithZone(""), endpoint.Port())
+}
+
+// Matches 判断代理地址和端口是否在监控范围内
+func (t *ProxyTargets) Matches(ip string, port uint16) bool {
+	if _, ok := t.ports[port]; ok {
+		return true
+	}
+	if len(t.endpoints) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	_, ok := t.endpoints[normalizeAddrPort(netip.AddrPortFrom(addr, port))]
+	return ok
+}
+
+// Ports 返回排序后的端口列表
+func (t *ProxyTargets) Ports() []uint16 {
+	ports := make([]uint16, 0, len(t.ports))
+	for port := range t.ports {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// Endpoints 返回排序后的代理地址列表
+func (t *ProxyTargets) Endpoints() []netip.AddrPort {
+	endpoints := make([]netip.AddrPort, 0, len(t.endpoints))
+	for endpoint := range t.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Compare(endpoints[j]) < 0 })
+	return endpoints
+}
+
+// String 返回适合日志输出的描述
+func (t *ProxyTargets) String() string {
+	parts := make([]string, 0, len(t.ports)+len(t.endpoints))
+	for _, port := range t.Ports() {
+		parts = append(parts, strconv.Itoa(int(port)))
+	}
+	for _, endpoint := range t.Endpoints() {
+		parts = append(parts, endpoint.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// proxyEndpointKey socks5_proxies 映射的键（与 struct proxy_endpoint 一致）
+type proxyEndpointKey struct {
+	Addr [16]byte // 网络字节序，IPv4 使用IPv4映射IPv6形式
+	Port uint16   // 主机字节序
+	_    uint16
+}
+
+// newProxyEndpointKey 构造内核映射键
+func newProxyEndpointKey(endpoint netip.AddrPort) proxyEndpointKey {
+	return proxyEndpointKey{
+		Addr: endpoint.Addr().As16(),
+		Port: endpoint.Port(),
+	}
+}
+
+// syncProxyTargets 将代理集合同步到内核映射：先删除不再需要的项再写入新增项，映射满时不会因新旧并存而失败
+// 新集合超出映射容量时直接返回错误，不修改内核映射
+func (o *ebpfObjects) syncProxyTargets(targets *ProxyTargets) error {
+	if n, max := len(targets.ports), o.Ports.MaxEntries(); uint32(n) > max {
+		return fmt.Errorf("代理端口数 %d 超过内核映射 socks5_ports 的容量 %d", n, max)
+	}
+	if n, max := len(targets.endpoints), o.Proxies.MaxEntries(); uint32(n) > max {
+		return fmt.Errorf("代理地址数 %d 超过内核映射 socks5_proxies 的容量 %d", n, max)
+	}
+
+	var existingPorts []uint16
+	var port uint16
+	var present uint8
+	iter := o.Ports.Iterate()
+	for iter.Next(&port, &present) {
+		existingPorts = append(existingPorts, port)
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("遍历 socks5_ports 失败: %w", err)
+	}
+
+	var existingEndpoints []proxyEndpointKey
+	var endpoint proxyEndpointKey
+	iter = o.Proxies.Iterate()
+	for iter.Next(&endpoint, &present) {
+		existingEndpoints = append(existingEndpoints, endpoint)
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("遍历 socks5_proxies 失败: %w", err)
+	}
+
+	for _, port := range existingPorts {
+		if _, ok := targets.ports[port]; ok {
+			continue
+		}
+		if err := o.Ports.Delete(port); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("删除 socks5_ports 失败 (端口: %d): %w", port, err)
+		}
+	}
+	for _, key := range existingEndpoints {
+		endpoint := normalizeAddrPort(netip.AddrPortFrom(netip.AddrFrom16(key.Addr), key.Port))
+		if _, ok := targets.endpoints[endpoint]; ok {
+			continue
+		}
+		if err := o.Proxies.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("删除 socks5_proxies 失败 (%s): %w", endpoint, err)
+		}
+	}
+
+	for port := range targets.ports {
+		if err := o.Ports.Put(port, uint8(1)); err != nil {
+			return fmt.Errorf("写入 socks5_ports 失败 (端口: %d): %w", port, err)
+		}
+	}
+	for endpoint := range targets.endpoints {
+		if err := o.Proxies.Put(newProxyEndpointKey(endpoint), uint8(1)); err != nil {
+			return fmt.Errorf("写入 socks5_proxies 失败 (%s): %w", endpoint, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package interceptor
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// newProxyTargetMaps 创建与 socks5_ports / socks5_proxies 结构相同、容量为 capacity 的映射，没有权限时跳过
+func newProxyTargetMaps(t *testing.T, capacity uint32) *ebpfObjects {
+	t.Helper()
+	ports, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Hash, KeySize: 2, ValueSize: 1, MaxEntries: capacity})
+	if err != nil {
+		t.Skipf("无法创建eBPF映射: %v", err)
+	}
+	t.Cleanup(func() { ports.Close() })
+	proxies, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Hash, KeySize: 20, ValueSize: 1, MaxEntries: capacity})
+	if err != nil {
+		t.Skipf("无法创建eBPF映射: %v", err)
+	}
+	t.Cleanup(func() { proxies.Close() })
+	return &ebpfObjects{ebpfMaps: ebpfMaps{Ports: ports, Proxies: proxies}}
+}
+
+// mapTargets 读取映射中的端口和地址，按 ProxyTargets.String 的格式输出
+func mapTargets(t *testing.T, objs *ebpfObjects) string {
+	t.Helper()
+	targets := newProxyTargets()
+	var port uint16
+	var present uint8
+	iter := objs.Ports.Iterate()
+	for iter.Next(&port, &present) {
+		targets.ports[port] = struct{}{}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterate socks5_ports: %v", err)
+	}
+	var key proxyEndpointKey
+	iter = objs.Proxies.Iterate()
+	for iter.Next(&key, &present) {
+		targets.endpoints[normalizeAddrPort(netip.AddrPortFrom(netip.AddrFrom16(key.Addr), key.Port))] = struct{}{}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterate socks5_proxies: %v", err)
+	}
+	return targets.String()
+}
+
+func TestSyncProxyTargets(t *testing.T) {
+	objs := newProxyTargetMaps(t, 4)
+
+	steps := []struct {
+		name      string
+		ports     string
+		endpoints string
+		want      string
+		wantErr   bool
+	}{
+		{"initial", "1080,1081,1082,1083", "10.0.0.1:1080,10.0.0.2:1080", "1080,1081,1082,1083,10.0.0.1:1080,10.0.0.2:1080", false},
+		// 映射已满，替换为完全不同的集合时需要先删除旧项
+		{"replace full map", "2080,2081,2082,2083", "10.0.0.3:1080,[2001:db8::1]:1080,10.0.0.4:1080,10.0.0.5:1080",
+			"2080,2081,2082,2083,10.0.0.3:1080,10.0.0.4:1080,10.0.0.5:1080,[2001:db8::1]:1080", false},
+		{"partial overlap", "2080,3080", "10.0.0.3:1080", "2080,3080,10.0.0.3:1080", false},
+		// 超出容量时返回错误，映射保持不变
+		{"ports exceed capacity", "1,2,3,4,5", "", "2080,3080,10.0.0.3:1080", true},
+		{"endpoints exceed capacity", "1080", "10.0.1.1:1,10.0.1.2:1,10.0.1.3:1,10.0.1.4:1,10.0.1.5:1", "2080,3080,10.0.0.3:1080", true},
+		{"ports only", "1080", "", "1080", false},
+	}
+
+	for _, step := range steps {
+		targets, err := ParseProxyTargets(step.ports, step.endpoints)
+		if err != nil {
+			t.Fatalf("%s: ParseProxyTargets: %v", step.name, err)
+		}
+		err = objs.syncProxyTargets(targets)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: syncProxyTargets() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if got := mapTargets(t, objs); got != step.want {
+			t.Errorf("%s: maps = %s, want %s", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package interceptor
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// FlowCounters 内核统计的单个连接流量（TCP负载字节，包含重传）
+type FlowCounters struct {
+	LastSeen    time.Time // 最后一个数据包的时间，零值表示未知
+	BytesUp     uint64    // 客户端 -> 代理
+	BytesDown   uint64    // 代理 -> 客户端
+	PacketsUp   uint64    // 客户端 -> 代理 携带负载的数据包
+	PacketsDown uint64    // 代理 -> 客户端 携带负载的数据包
+}
+
+// FlowStatsSource 查询连接在内核中的流量计数和最后活跃时间
+// 握手完成后内核不再上报数据段，长连接的流量和活跃度只能从内核的流状态得知
+type FlowStatsSource func(session *SOCKS5Session) (FlowCounters, bool)
+
+// SetFlowStatsSource 设置流量计数来源，为 nil 时只使用已观察到的事件
+func (m *EnhancedSOCKS5Monitor) SetFlowStatsSource(source FlowStatsSource) {
+	if source == nil {
+		m.flowStats.Store(nil)
+		return
+	}
+	m.flowStats.Store(&source)
+}
+
+// handshakeTraffic 握手阶段经过状态机的流量，从内核计数中扣除后得到隧道流量
+type handshakeTraffic struct {
+	bytes   [2]uint64 // 按 Direction 索引
+	packets [2]uint64
+}
+
+// add 记录一个握手阶段的数据段
+func (h *handshakeTraffic) add(dir Direction, segLen uint32) {
+	if segLen == 0 || int(dir) >= len(h.bytes) {
+		return
+	}
+	h.bytes[dir] += uint64(segLen)
+	h.packets[dir]++
+}
+
+// saturatingSub 计数可能因内核上报顺序暂时小于握手部分，不允许回绕
+func saturatingSub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// applyCounters 用内核计数更新会话的隧道流量和活跃时间（调用方需持有分片锁）
+func (conn *socks5Conn) applyCounters(counters FlowCounters) {
+	session := conn.session
+	hs := &conn.handshake
+
+	// 计数只增不减，连接删除后再查询到的零值不覆盖已有结果
+	if up := saturatingSub(counters.BytesUp, hs.bytes[DirectionClientToProxy]); up > session.BytesUp {
+		session.BytesUp = up
+	}
+	if down := saturatingSub(counters.BytesDown, hs.bytes[DirectionProxyToClient]); down > session.BytesDown {
+		session.BytesDown = down
+	}
+	if up := saturatingSub(counters.PacketsUp, hs.packets[DirectionClientToProxy]); up > session.PacketsUp {
+		session.PacketsUp = up
+	}
+	if down := saturatingSub(counters.PacketsDown, hs.packets[DirectionProxyToClient]); down > session.PacketsDown {
+		session.PacketsDown = down
+	}
+	if counters.LastSeen.After(session.LastActivity) {
+		session.LastActivity = counters.LastSeen
+	}
+}
+
+// refreshFlowStats 从内核流状态刷新未关闭会话的流量（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) refreshFlowStats(conn *socks5Conn) {
+	if !conn.session.CloseTime.IsZero() {
+		return
+	}
+	source := m.flowStats.Load()
+	if source == nil {
+		return
+	}
+	if counters, ok := (*source)(conn.session); ok {
+		conn.applyCounters(counters)
+	}
+}
+
+// ProxyTraffic 单个上游代理的累计隧道流量
+type ProxyTraffic struct {
+	Proxy       string // 代理 IP:端口
+	Sessions    uint64 // 会话数（含已清理的会话）
+	Active      uint64 // 尚未关闭的会话数
+	BytesUp     uint64
+	BytesDown   uint64
+	PacketsUp   uint64
+	PacketsDown uint64
+}
+
+// add 累加一个会话的流量
+func (t *ProxyTraffic) add(session *SOCKS5Session) {
+	t.Sessions++
+	t.BytesUp += session.BytesUp
+	t.BytesDown += session.BytesDown
+	t.PacketsUp += session.PacketsUp
+	t.PacketsDown += session.PacketsDown
+}
+
+// retireTraffic 会话被清理前把流量并入所属代理的历史累计
+func (m *EnhancedSOCKS5Monitor) retireTraffic(session *SOCKS5Session) {
+	proxy := joinHostPort(session.ProxyIP, session.ProxyPort)
+
+	m.trafficMu.Lock()
+	defer m.trafficMu.Unlock()
+	if m.retiredTraffic == nil {
+		m.retiredTraffic = make(map[string]*ProxyTraffic)
+	}
+	total, ok := m.retiredTraffic[proxy]
+	if !ok {
+		total = &ProxyTraffic{Proxy: proxy}
+		m.retiredTraffic[proxy] = total
+	}
+	total.add(session)
+}
+
+// ProxyTraffic 返回每个上游代理的累计流量（已清理会话 + 当前会话），按代理排序
+func (m *EnhancedSOCKS5Monitor) ProxyTraffic() []ProxyTraffic {
+	totals := make(map[string]*ProxyTraffic)
+
+	m.trafficMu.Lock()
+	for proxy, retired := range m.retiredTraffic {
+		total := *retired
+		totals[proxy] = &total
+	}
+	m.trafficMu.Unlock()
+
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		for _, conn := range shard.conns {
+			session := conn.session
+			proxy := joinHostPort(session.ProxyIP, session.ProxyPort)
+			total, ok := totals[proxy]
+			if !ok {
+				total = &ProxyTraffic{Proxy: proxy}
+				totals[proxy] = total
+			}
+			total.add(session)
+			if session.CloseTime.IsZero() {
+				total.Active++
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	result := make([]ProxyTraffic, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Proxy < result[j].Proxy })
+	return result
+}
+
+// flowCounters 从 socks5_flows 读取连接的流量计数和最后出现数据包的时间
+func (o *ebpfObjects) flowCounters(session *SOCKS5Session) (FlowCounters, bool) {
+	addr, err := netip.ParseAddr(session.ClientIP)
+	if err != nil {
+		return FlowCounters{}, false
+	}
+
+	key := flowKey{
+		ClientAddr: addr.As16(),
+		ClientPort: session.ClientPort,
+		ProxyPort:  session.ProxyPort,
+	}
+	var state flowState
+	if err := o.Flows.Lookup(&key, &state); err != nil {
+		return FlowCounters{}, false
+	}
+	return FlowCounters{
+		LastSeen:    monotonicToTime(state.LastSeen),
+		BytesUp:     state.BytesUp,
+		BytesDown:   state.BytesDown,
+		PacketsUp:   state.PacketsUp,
+		PacketsDown: state.PacketsDown,
+	}, true
+}
@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// socketAttributionPrograms 在进程上下文中记录 socket cookie -> 进程 的fentry程序
+type socketAttributionPrograms struct {
+	TraceTCPConnect *ebpf.Program `ebpf:"trace_tcp_connect"`
+	TraceTCPSendmsg *ebpf.Program `ebpf:"trace_tcp_sendmsg"`
+}
+
+// socketAttribution 进程归属程序及其挂载状态
+// TC分类器运行在软中断或任意进程上下文中，bpf_get_current_pid_tgid() 无意义，
+// 因此在 tcp_connect/tcp_sendmsg 处按 socket cookie 记录所属进程，TC事件再按cookie关联
+type socketAttribution struct {
+	socketAttributionPrograms
+	links []link.Link
+	err   error // 加载或挂载失败的原因，非空时事件中的PID为0
+}
+
+// loadSocketAttribution 加载fentry程序，复用已创建的共享映射
+func loadSocketAttribution(spec *ebpf.CollectionSpec, opts *ebpf.CollectionOptions) (*socketAttribution, error) {
+	attribution := &socketAttribution{}
+	if err := spec.LoadAndAssign(&attribution.socketAttributionPrograms, opts); err != nil {
+		return nil, err
+	}
+	return attribution, nil
+}
+
+// Attach 挂载fentry程序，全部成功才视为可用
+func (a *socketAttribution) Attach() error {
+	if a.err != nil {
+		return a.err
+	}
+
+	for _, prog := range []*ebpf.Program{a.TraceTCPConnect, a.TraceTCPSendmsg} {
+		l, err := link.AttachTracing(link.TracingOptions{Program: prog})
+		if err != nil {
+			a.err = &EbpfError{Stage: EbpfStageAttach, Program: prog.String(), Err: err}
+			a.closeLinks()
+			return a.err
+		}
+		a.links = append(a.links, l)
+	}
+	return nil
+}
+
+// Mode 返回进程归属方式，用于状态报告
+func (a *socketAttribution) Mode() string {
+	if a == nil || a.err != nil || len(a.links) == 0 {
+		return "unavailable"
+	}
+	return "fentry"
+}
+
+// Err 返回不可用的原因
+func (a *socketAttribution) Err() error {
+	if a == nil {
+		return fmt.Errorf("未加载进程归属程序")
+	}
+	return a.err
+}
+
+// closeLinks 卸载已挂载的fentry程序
+func (a *socketAttribution) closeLinks() error {
+	var errs []error
+	for i := len(a.links) - 1; i >= 0; i-- {
+		if err := a.links[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	a.links = nil
+	return errors.Join(errs...)
+}
+
+// Close 卸载并释放程序
+func (a *socketAttribution) Close() error {
+	errs := []error{a.closeLinks()}
+	for _, prog := range []*ebpf.Program{a.TraceTCPConnect, a.TraceTCPSendmsg} {
+		if prog == nil {
+			continue
+		}
+		if err := prog.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
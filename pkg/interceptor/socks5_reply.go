@@ -0,0 +1,135 @@
+package interceptor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// SOCKS5ReplyCode RFC 1928 应答中的 REP 字段
+type SOCKS5ReplyCode byte
+
+const (
+	ReplySucceeded               SOCKS5ReplyCode = 0x00
+	ReplyGeneralFailure          SOCKS5ReplyCode = 0x01
+	ReplyNotAllowedByRuleset     SOCKS5ReplyCode = 0x02
+	ReplyNetworkUnreachable      SOCKS5ReplyCode = 0x03
+	ReplyHostUnreachable         SOCKS5ReplyCode = 0x04
+	ReplyConnectionRefused       SOCKS5ReplyCode = 0x05
+	ReplyTTLExpired              SOCKS5ReplyCode = 0x06
+	ReplyCommandNotSupported     SOCKS5ReplyCode = 0x07
+	ReplyAddressTypeNotSupported SOCKS5ReplyCode = 0x08
+)
+
+// String 返回 REP 的标准名称，适合作为告警和指标标签
+func (c SOCKS5ReplyCode) String() string {
+	switch c {
+	case ReplySucceeded:
+		return "succeeded"
+	case ReplyGeneralFailure:
+		return "general_failure"
+	case ReplyNotAllowedByRuleset:
+		return "not_allowed_by_ruleset"
+	case ReplyNetworkUnreachable:
+		return "network_unreachable"
+	case ReplyHostUnreachable:
+		return "host_unreachable"
+	case ReplyConnectionRefused:
+		return "connection_refused"
+	case ReplyTTLExpired:
+		return "ttl_expired"
+	case ReplyCommandNotSupported:
+		return "command_not_supported"
+	case ReplyAddressTypeNotSupported:
+		return "address_type_not_supported"
+	default:
+		return fmt.Sprintf("unassigned_0x%02x", byte(c))
+	}
+}
+
+// Description 返回 REP 的中文说明
+func (c SOCKS5ReplyCode) Description() string {
+	switch c {
+	case ReplySucceeded:
+		return "成功"
+	case ReplyGeneralFailure:
+		return "代理服务器一般性故障"
+	case ReplyNotAllowedByRuleset:
+		return "规则集不允许连接"
+	case ReplyNetworkUnreachable:
+		return "网络不可达"
+	case ReplyHostUnreachable:
+		return "主机不可达"
+	case ReplyConnectionRefused:
+		return "连接被拒绝"
+	case ReplyTTLExpired:
+		return "TTL已过期"
+	case ReplyCommandNotSupported:
+		return "不支持的命令"
+	case ReplyAddressTypeNotSupported:
+		return "不支持的地址类型"
+	default:
+		return fmt.Sprintf("未定义的错误码(0x%02x)", byte(c))
+	}
+}
+
+// Succeeded 是否为成功应答
+func (c SOCKS5ReplyCode) Succeeded() bool {
+	return c == ReplySucceeded
+}
+
+// SOCKS5Reply 解码后的代理应答：VER REP RSV ATYP BND.ADDR BND.PORT
+type SOCKS5Reply struct {
+	Code      SOCKS5ReplyCode
+	AddrType  byte
+	BoundAddr string
+	BoundPort uint16
+}
+
+// BoundEndpoint 返回 BND.ADDR:BND.PORT
+func (r SOCKS5Reply) BoundEndpoint() string {
+	return joinHostPort(r.BoundAddr, r.BoundPort)
+}
+
+// decodeSOCKS5Reply 解码完整的应答报文
+func decodeSOCKS5Reply(data []byte) (SOCKS5Reply, error) {
+	host, port, err := decodeSOCKS5Address(data)
+	if err != nil {
+		return SOCKS5Reply{}, err
+	}
+
+	return SOCKS5Reply{
+		Code:      SOCKS5ReplyCode(data[1]),
+		AddrType:  data[3],
+		BoundAddr: host,
+		BoundPort: port,
+	}, nil
+}
+
+// decodeSOCKS5Address 解码请求/应答报文中 ATYP 之后的地址和端口
+func decodeSOCKS5Address(data []byte) (host string, port uint16, err error) {
+	total, complete, err := socks5AddressMessageLen(data)
+	if err != nil {
+		return "", 0, err
+	}
+	if !complete {
+		return "", 0, fmt.Errorf("报文不完整: %d < %d", len(data), total)
+	}
+
+	switch data[3] {
+	case socks5AtypIPv4:
+		host = fmt.Sprintf("%d.%d.%d.%d", data[4], data[5], data[6], data[7])
+	case socks5AtypDomain:
+		host = string(data[5 : 5+int(data[4])])
+	case socks5AtypIPv6:
+		host = net.IP(data[4:20]).String()
+	}
+	port = uint16(data[total-2])<<8 | uint16(data[total-1])
+
+	return host, port, nil
+}
+
+// joinHostPort 拼接地址和端口，IPv6地址加方括号
+func joinHostPort(host string, port uint16) string {
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
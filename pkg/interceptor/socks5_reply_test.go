@@ -0,0 +1,115 @@
+package interceptor
+
+import (
+	"net"
+	"testing"
+)
+
+// replyPacket 构造 VER REP RSV ATYP BND.ADDR BND.PORT
+func replyPacket(rep, atyp byte, addr []byte, port uint16) []byte {
+	data := []byte{socks5Version, rep, 0x00, atyp}
+	data = append(data, addr...)
+	return append(data, byte(port>>8), byte(port))
+}
+
+func TestDecodeSOCKS5Reply(t *testing.T) {
+	ipv4 := []byte{192, 0, 2, 10}
+	ipv6 := net.ParseIP("2001:db8::1").To16()
+	domain := append([]byte{byte(len("proxy.example"))}, "proxy.example"...)
+
+	cases := []struct {
+		name    string
+		data    []byte
+		want    SOCKS5Reply
+		wantErr bool
+	}{
+		{"succeeded ipv4", replyPacket(0x00, socks5AtypIPv4, ipv4, 1080),
+			SOCKS5Reply{Code: ReplySucceeded, AddrType: socks5AtypIPv4, BoundAddr: "192.0.2.10", BoundPort: 1080}, false},
+		{"succeeded domain", replyPacket(0x00, socks5AtypDomain, domain, 443),
+			SOCKS5Reply{Code: ReplySucceeded, AddrType: socks5AtypDomain, BoundAddr: "proxy.example", BoundPort: 443}, false},
+		{"succeeded ipv6", replyPacket(0x00, socks5AtypIPv6, ipv6, 65535),
+			SOCKS5Reply{Code: ReplySucceeded, AddrType: socks5AtypIPv6, BoundAddr: "2001:db8::1", BoundPort: 65535}, false},
+		{"empty domain", replyPacket(0x01, socks5AtypDomain, []byte{0}, 0),
+			SOCKS5Reply{Code: ReplyGeneralFailure, AddrType: socks5AtypDomain, BoundAddr: "", BoundPort: 0}, false},
+		{"truncated ipv4", replyPacket(0x00, socks5AtypIPv4, ipv4, 1080)[:9], SOCKS5Reply{}, true},
+		{"truncated ipv6", replyPacket(0x00, socks5AtypIPv6, ipv6, 1080)[:12], SOCKS5Reply{}, true},
+		{"truncated domain", replyPacket(0x00, socks5AtypDomain, domain, 1080)[:8], SOCKS5Reply{}, true},
+		{"missing domain length", []byte{socks5Version, 0x00, 0x00, socks5AtypDomain}, SOCKS5Reply{}, true},
+		{"header only", []byte{socks5Version, 0x00, 0x00}, SOCKS5Reply{}, true},
+		{"unknown atyp", replyPacket(0x00, 0x02, ipv4, 1080), SOCKS5Reply{}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeSOCKS5Reply(tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("decodeSOCKS5Reply() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("decodeSOCKS5Reply() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSOCKS5ReplyCodes(t *testing.T) {
+	cases := []struct {
+		code        SOCKS5ReplyCode
+		name        string
+		description string
+		succeeded   bool
+	}{
+		{ReplySucceeded, "succeeded", "成功", true},
+		{ReplyGeneralFailure, "general_failure", "代理服务器一般性故障", false},
+		{ReplyNotAllowedByRuleset, "not_allowed_by_ruleset", "规则集不允许连接", false},
+		{ReplyNetworkUnreachable, "network_unreachable", "网络不可达", false},
+		{ReplyHostUnreachable, "host_unreachable", "主机不可达", false},
+		{ReplyConnectionRefused, "connection_refused", "连接被拒绝", false},
+		{ReplyTTLExpired, "ttl_expired", "TTL已过期", false},
+		{ReplyCommandNotSupported, "command_not_supported", "不支持的命令", false},
+		{ReplyAddressTypeNotSupported, "address_type_not_supported", "不支持的地址类型", false},
+		{0x09, "unassigned_0x09", "未定义的错误码(0x09)", false},
+		{0xff, "unassigned_0xff", "未定义的错误码(0xff)", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.code.String(); got != tc.name {
+				t.Errorf("String() = %q, want %q", got, tc.name)
+			}
+			if got := tc.code.Description(); got != tc.description {
+				t.Errorf("Description() = %q, want %q", got, tc.description)
+			}
+			if got := tc.code.Succeeded(); got != tc.succeeded {
+				t.Errorf("Succeeded() = %v, want %v", got, tc.succeeded)
+			}
+
+			// 每个 REP 都应被完整解码，并决定握手的结果
+			reply, err := decodeSOCKS5Reply(replyPacket(byte(tc.code), socks5AtypIPv4, []byte{10, 0, 0, 1}, 80))
+			if err != nil {
+				t.Fatalf("decodeSOCKS5Reply() error = %v", err)
+			}
+			if reply.Code != tc.code {
+				t.Errorf("Code = %v, want %v", reply.Code, tc.code)
+			}
+
+			m := newTestMonitor()
+			handshake(m, "10.0.1.1", 40001, "alice", "secret", byte(tc.code))
+			sessions := m.Sessions()
+			if len(sessions) != 1 {
+				t.Fatalf("Sessions() = %d, want 1", len(sessions))
+			}
+			session := sessions[0]
+			wantPhase, wantOutcome := PhaseFailed, OutcomeReplyError
+			if tc.succeeded {
+				wantPhase, wantOutcome = PhaseEstablished, OutcomeSuccess
+			}
+			if session.Phase != wantPhase || session.Outcome != wantOutcome {
+				t.Errorf("phase/outcome = %s/%s, want %s/%s", session.Phase, session.Outcome, wantPhase, wantOutcome)
+			}
+			if session.Reply == nil || session.Reply.Code != tc.code || session.Reply.BoundEndpoint() != "1.2.3.4:80" {
+				t.Errorf("Reply = %+v, want code %v bound 1.2.3.4:80", session.Reply, tc.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,494 @@
+package interceptor
+
+import (
+	"fmt"
+	"log"
+)
+
+// Direction 数据段的发送方向
+type Direction uint8
+
+const (
+	DirectionClientToProxy Direction = iota // 客户端 -> 代理
+	DirectionProxyToClient                  // 代理 -> 客户端
+)
+
+// String 返回方向描述
+func (d Direction) String() string {
+	if d == DirectionProxyToClient {
+		return "proxy->client"
+	}
+	return "client->proxy"
+}
+
+// SOCKS5Phase SOCKS5握手阶段，表示当前正在等待的报文
+type SOCKS5Phase string
+
+const (
+	PhaseGreeting        SOCKS5Phase = "greeting"         // 等待客户端问候（VER NMETHODS METHODS）
+	PhaseMethodSelection SOCKS5Phase = "method_selection" // 等待代理选择认证方法
+	PhaseSubNegotiation  SOCKS5Phase = "sub_negotiation"  // RFC 1929 用户名密码子协商
+	PhaseRequest         SOCKS5Phase = "request"          // 等待客户端请求（CONNECT等）
+	PhaseReply           SOCKS5Phase = "reply"            // 等待代理应答
+	PhaseEstablished     SOCKS5Phase = "established"      // 握手完成，进入数据转发
+	PhaseFailed          SOCKS5Phase = "failed"           // 握手失败或协议错误
+)
+
+// Terminal 是否为终止阶段，终止后不再解析后续数据
+func (p SOCKS5Phase) Terminal() bool {
+	return p == PhaseEstablished || p == PhaseFailed
+}
+
+// 协议常量
+const (
+	socks5Version       = 0x05
+	userPassAuthVersion = 0x01
+
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPass     = 0x02
+	socks5MethodNoAcceptable = 0xFF
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+)
+
+// maxDirectionBuffer 单方向未解析数据的上限，超出时以 OutcomeBufferOverflow 终止握手
+const maxDirectionBuffer = 4096
+
+// socks5Conn 单个连接的协议状态
+type socks5Conn struct {
+	session      *SOCKS5Session
+	clientBuf    []byte             // 客户端 -> 代理，尚未消费的字节
+	serverBuf    []byte             // 代理 -> 客户端，尚未消费的字节
+	clientStream *streamReassembler // 客户端 -> 代理 的TCP重组
+	serverStream *streamReassembler // 代理 -> 客户端 的TCP重组
+	authSent     bool               // 子协商阶段中客户端是否已发送凭据
+	serverSeen   bool               // 是否观察到代理方向的流量，观察到后不再推断代理报文
+	inferred     []SOCKS5Phase      // 已推断但尚未观察到的代理报文，迟到的代理报文按推断时的阶段消费
+	handshake    handshakeTraffic   // 握手阶段的流量，计算隧道流量时扣除
+	timing       handshakeTiming    // 握手报文的内核时间戳
+}
+
+// release 释放重组缓冲
+func (conn *socks5Conn) release() {
+	if conn.clientStream != nil {
+		conn.clientStream.Release()
+	}
+	if conn.serverStream != nil {
+		conn.serverStream.Release()
+	}
+}
+
+// feedSegment 按TCP序列号重组数据段，再把连续的字节交给状态机（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) feedSegment(conn *socks5Conn, dir Direction, seq uint32, data []byte, segLen uint32) {
+	if conn.session.Phase.Terminal() {
+		return
+	}
+
+	stream := &conn.clientStream
+	if dir == DirectionProxyToClient {
+		stream = &conn.serverStream
+		// 乱序到达、暂未输出的代理数据段同样说明入站捕获生效
+		conn.serverSeen = true
+	}
+	if *stream == nil {
+		*stream = newStreamReassembler(&m.reassembly)
+	}
+
+	out, gap := (*stream).Push(seq, data, segLen)
+	if len(out) > 0 {
+		m.feed(conn, dir, out)
+	}
+
+	// 缺口两侧的字节不连续，已缓冲的半个报文无法再补齐
+	if gap && !conn.session.Phase.Terminal() {
+		buf := &conn.clientBuf
+		if dir == DirectionProxyToClient {
+			buf = &conn.serverBuf
+		}
+		if len(*buf) > 0 {
+			conn.fail(fmt.Sprintf("%s 数据流存在无法补齐的缺口", dir))
+			conn.clientBuf = nil
+			conn.serverBuf = nil
+		}
+	}
+	if conn.session.Phase.Terminal() {
+		conn.release()
+		m.finishHandshake(conn, classifyOutcome(conn.session))
+	}
+}
+
+// feed 追加一个数据段并尽可能推进状态机（调用方需持有分片锁）
+func (m *EnhancedSOCKS5Monitor) feed(conn *socks5Conn, dir Direction, data []byte) {
+	if conn.session.Phase.Terminal() {
+		return
+	}
+
+	buf := &conn.clientBuf
+	if dir == DirectionProxyToClient {
+		buf = &conn.serverBuf
+		conn.serverSeen = true
+	}
+	// 未解析的字节超过上限时不再截断继续解析，截断后的报文边界不可信
+	if len(*buf)+len(data) > maxDirectionBuffer {
+		conn.fail(fmt.Sprintf("握手缓冲区溢出: %s 未解析数据 %d 字节，上限 %d 字节", dir, len(*buf)+len(data), maxDirectionBuffer))
+		conn.clientBuf = nil
+		conn.serverBuf = nil
+		m.finishHandshake(conn, OutcomeBufferOverflow)
+		return
+	}
+	*buf = append(*buf, data...)
+
+	for !conn.session.Phase.Terminal() && m.step(conn) {
+	}
+
+	if conn.session.Phase.Terminal() {
+		conn.clientBuf = nil
+		conn.serverBuf = nil
+		m.finishHandshake(conn, classifyOutcome(conn.session))
+	}
+}
+
+// step 尝试完成当前阶段，返回是否有进展
+// 客户端报文可能先于之前的代理应答到达（不同CPU的perf缓冲区之间没有顺序），
+// 因此只有在从未观察到代理方向流量时才推断代理报文，已推断的报文迟到时按推断时的阶段消费
+func (m *EnhancedSOCKS5Monitor) step(conn *socks5Conn) bool {
+	if len(conn.inferred) > 0 && len(conn.serverBuf) > 0 {
+		return m.parseInferred(conn)
+	}
+
+	switch conn.session.Phase {
+	case PhaseGreeting:
+		return m.parseGreeting(conn)
+	case PhaseMethodSelection:
+		if len(conn.serverBuf) > 0 {
+			return m.parseMethodSelection(conn)
+		}
+		if conn.serverSeen {
+			return false
+		}
+		return m.inferMethodSelection(conn)
+	case PhaseSubNegotiation:
+		if !conn.authSent {
+			return m.parseUserPassAuth(conn)
+		}
+		if len(conn.serverBuf) > 0 {
+			return m.parseAuthStatus(conn)
+		}
+		if conn.serverSeen {
+			return false
+		}
+		return m.inferAuthStatus(conn)
+	case PhaseRequest:
+		return m.parseRequest(conn)
+	case PhaseReply:
+		if len(conn.serverBuf) > 0 {
+			return m.parseReply(conn)
+		}
+		if conn.serverSeen {
+			// 请求之后的客户端数据属于隧道流量，不再解析，等待真实的代理应答
+			conn.clientBuf = nil
+			return false
+		}
+		return m.inferReply(conn)
+	}
+	return false
+}
+
+// parseInferred 消费迟到的代理报文：报文对应最早一个已推断的阶段，而不是当前阶段
+func (m *EnhancedSOCKS5Monitor) parseInferred(conn *socks5Conn) bool {
+	switch conn.inferred[0] {
+	case PhaseMethodSelection:
+		inferredMethod := conn.session.SelectedMethod
+		method, ok := m.consumeMethodSelection(conn)
+		if !ok {
+			return false
+		}
+		conn.inferred = conn.inferred[1:]
+		m.handleMethodSelection(conn.session, method, true)
+		if method != inferredMethod {
+			return conn.fail(fmt.Sprintf("代理选择的认证方法 %s 与推断的 %s 不一致", socks5MethodName(method), socks5MethodName(inferredMethod)))
+		}
+		return true
+	case PhaseSubNegotiation:
+		if !m.consumeAuthStatus(conn) {
+			return false
+		}
+		conn.inferred = conn.inferred[1:]
+		return true
+	}
+	return false
+}
+
+// advance 进入下一阶段
+func (conn *socks5Conn) advance(phase SOCKS5Phase) {
+	conn.session.Phase = phase
+}
+
+// fail 以指定原因终止状态机
+func (conn *socks5Conn) fail(reason string) bool {
+	conn.session.Phase = PhaseFailed
+	conn.session.StopReason = reason
+	log.Printf("❌ [SOCKS5-状态机] 会话 %s 终止: %s", conn.session.SessionID, reason)
+	return false
+}
+
+// parseGreeting 解析客户端问候：VER NMETHODS METHODS
+func (m *EnhancedSOCKS5Monitor) parseGreeting(conn *socks5Conn) bool {
+	data := conn.clientBuf
+	if len(data) < 1 {
+		return false
+	}
+
+	// 捕获从子协商开始（例如仅收到内核上报的认证事件），直接进入子协商
+	if data[0] == userPassAuthVersion {
+		conn.advance(PhaseSubNegotiation)
+		return true
+	}
+
+	if data[0] != socks5Version {
+		return conn.fail(fmt.Sprintf("问候版本错误: 0x%02x", data[0]))
+	}
+	if len(data) < 2 {
+		return false
+	}
+
+	methodCount := int(data[1])
+	if methodCount == 0 {
+		return conn.fail("客户端未提供认证方法")
+	}
+	if len(data) < 2+methodCount {
+		return false
+	}
+
+	m.handleAuthNegotiation(conn.session, data[:2+methodCount])
+	conn.timing.greeting = conn.timing.sent()
+	conn.clientBuf = data[2+methodCount:]
+	conn.advance(PhaseMethodSelection)
+	return true
+}
+
+// parseMethodSelection 解析代理的方法选择：VER METHOD
+func (m *EnhancedSOCKS5Monitor) parseMethodSelection(conn *socks5Conn) bool {
+	method, ok := m.consumeMethodSelection(conn)
+	if !ok {
+		return false
+	}
+	return m.applyMethod(conn, method, true)
+}
+
+// consumeMethodSelection 从代理数据中取出方法选择报文，数据不完整或版本错误时返回 false
+func (m *EnhancedSOCKS5Monitor) consumeMethodSelection(conn *socks5Conn) (byte, bool) {
+	data := conn.serverBuf
+	if len(data) < 2 {
+		return 0, false
+	}
+	if data[0] != socks5Version {
+		return 0, conn.fail(fmt.Sprintf("方法选择版本错误: 0x%02x", data[0]))
+	}
+
+	conn.serverBuf = data[2:]
+	m.observeRTT(conn, LatencyMethod, conn.timing.greeting)
+	return data[1], true
+}
+
+// applyMethod 根据代理选择的方法推进状态机
+func (m *EnhancedSOCKS5Monitor) applyMethod(conn *socks5Conn, method byte, observed bool) bool {
+	m.handleMethodSelection(conn.session, method, observed)
+
+	switch method {
+	case socks5MethodNoAuth:
+		conn.advance(PhaseRequest)
+		return true
+	case socks5MethodUserPass:
+		conn.advance(PhaseSubNegotiation)
+		return true
+	case socks5MethodNoAcceptable:
+		return conn.fail("代理拒绝所有认证方法")
+	default:
+		return conn.fail(fmt.Sprintf("不支持的认证方法: 0x%02x", method))
+	}
+}
+
+// inferMethodSelection 未观察到代理应答时，根据客户端后续报文推断所选方法
+func (m *EnhancedSOCKS5Monitor) inferMethodSelection(conn *socks5Conn) bool {
+	if len(conn.clientBuf) == 0 {
+		return false
+	}
+
+	switch conn.clientBuf[0] {
+	case userPassAuthVersion:
+		conn.inferred = append(conn.inferred, PhaseMethodSelection)
+		return m.applyMethod(conn, socks5MethodUserPass, false)
+	case socks5Version:
+		conn.inferred = append(conn.inferred, PhaseMethodSelection)
+		return m.applyMethod(conn, socks5MethodNoAuth, false)
+	default:
+		return conn.fail(fmt.Sprintf("方法选择后客户端报文无法识别: 0x%02x", conn.clientBuf[0]))
+	}
+}
+
+// parseUserPassAuth 解析RFC 1929用户名密码认证：VER ULEN UNAME PLEN PASSWD
+func (m *EnhancedSOCKS5Monitor) parseUserPassAuth(conn *socks5Conn) bool {
+	data := conn.clientBuf
+	if len(data) < 2 {
+		return false
+	}
+	if data[0] != userPassAuthVersion {
+		return conn.fail(fmt.Sprintf("子协商版本错误: 0x%02x", data[0]))
+	}
+
+	usernameLen := int(data[1])
+	if len(data) < 2+usernameLen+1 {
+		return false
+	}
+	passwordLen := int(data[2+usernameLen])
+	total := 2 + usernameLen + 1 + passwordLen
+	if len(data) < total {
+		return false
+	}
+
+	username := string(data[2 : 2+usernameLen])
+	password := string(data[2+usernameLen+1 : total])
+	// 内核事件中被截断的凭据已由后续数据段补齐
+	conn.session.Truncated &^= TruncatedUsername | TruncatedPassword
+	m.handleUsernamePasswordAuth(conn.session, username, password)
+
+	conn.clientBuf = data[total:]
+	conn.authSent = true
+	conn.timing.authSent = conn.timing.sent()
+	return true
+}
+
+// parseAuthStatus 解析代理的子协商结果：VER STATUS
+func (m *EnhancedSOCKS5Monitor) parseAuthStatus(conn *socks5Conn) bool {
+	if !m.consumeAuthStatus(conn) {
+		return false
+	}
+	conn.advance(PhaseRequest)
+	return true
+}
+
+// consumeAuthStatus 从代理数据中取出认证结果并记录，数据不完整、版本错误或认证失败时返回 false
+func (m *EnhancedSOCKS5Monitor) consumeAuthStatus(conn *socks5Conn) bool {
+	data := conn.serverBuf
+	if len(data) < 2 {
+		return false
+	}
+	if data[0] != userPassAuthVersion {
+		return conn.fail(fmt.Sprintf("认证结果版本错误: 0x%02x", data[0]))
+	}
+
+	status := data[1]
+	conn.serverBuf = data[2:]
+	m.observeRTT(conn, LatencyAuth, conn.timing.authSent)
+	m.handleAuthStatus(conn.session, status)
+	if status != 0x00 {
+		return conn.fail(fmt.Sprintf("代理拒绝认证(状态: 0x%02x)", status))
+	}
+	return true
+}
+
+// inferAuthStatus 未观察到认证结果时，客户端继续发送请求即视为认证通过
+func (m *EnhancedSOCKS5Monitor) inferAuthStatus(conn *socks5Conn) bool {
+	if len(conn.clientBuf) == 0 {
+		return false
+	}
+	if conn.clientBuf[0] != socks5Version {
+		return conn.fail(fmt.Sprintf("认证后客户端报文无法识别: 0x%02x", conn.clientBuf[0]))
+	}
+
+	conn.session.AuthResult = AuthResultInferred
+	conn.session.Status = "认证通过(推断)"
+	conn.inferred = append(conn.inferred, PhaseSubNegotiation)
+	conn.advance(PhaseRequest)
+	return true
+}
+
+// parseRequest 解析客户端请求：VER CMD RSV ATYP DST.ADDR DST.PORT
+func (m *EnhancedSOCKS5Monitor) parseRequest(conn *socks5Conn) bool {
+	data := conn.clientBuf
+	if len(data) < 1 {
+		return false
+	}
+	if data[0] != socks5Version {
+		return conn.fail(fmt.Sprintf("请求版本错误: 0x%02x", data[0]))
+	}
+
+	total, complete, err := socks5AddressMessageLen(data)
+	if err != nil {
+		return conn.fail(fmt.Sprintf("请求%v", err))
+	}
+	if !complete {
+		return false
+	}
+
+	m.handleConnectRequest(conn.session, data[:total])
+	conn.timing.request = conn.timing.sent()
+	conn.clientBuf = data[total:]
+	conn.advance(PhaseReply)
+	return true
+}
+
+// parseReply 解析代理应答：VER REP RSV ATYP BND.ADDR BND.PORT
+func (m *EnhancedSOCKS5Monitor) parseReply(conn *socks5Conn) bool {
+	data := conn.serverBuf
+	if data[0] != socks5Version {
+		return conn.fail(fmt.Sprintf("应答版本错误: 0x%02x", data[0]))
+	}
+
+	total, complete, err := socks5AddressMessageLen(data)
+	if err != nil {
+		return conn.fail(fmt.Sprintf("应答%v", err))
+	}
+	if !complete {
+		return false
+	}
+
+	m.handleConnectResponse(conn.session, data[:total])
+	m.observeRTT(conn, LatencyConnect, conn.timing.request)
+	conn.serverBuf = data[total:]
+	if rep := SOCKS5ReplyCode(data[1]); !rep.Succeeded() {
+		return conn.fail(fmt.Sprintf("代理应答失败(REP: %s)", rep))
+	}
+
+	conn.advance(PhaseEstablished)
+	conn.session.StopReason = "握手完成"
+	return false
+}
+
+// inferReply 未观察到代理应答时，客户端开始发送业务数据即视为连接建立
+func (m *EnhancedSOCKS5Monitor) inferReply(conn *socks5Conn) bool {
+	if len(conn.clientBuf) == 0 {
+		return false
+	}
+
+	conn.advance(PhaseEstablished)
+	conn.session.StopReason = "握手完成(未观察到代理应答)"
+	return false
+}
+
+// socks5AddressMessageLen 计算请求/应答报文总长度：4字节头 + 地址 + 2字节端口
+// complete 为 false 表示数据尚不完整
+func socks5AddressMessageLen(data []byte) (total int, complete bool, err error) {
+	if len(data) < 4 {
+		return 0, false, nil
+	}
+
+	switch data[3] {
+	case socks5AtypIPv4:
+		total = 4 + 4 + 2
+	case socks5AtypIPv6:
+		total = 4 + 16 + 2
+	case socks5AtypDomain:
+		if len(data) < 5 {
+			return 0, false, nil
+		}
+		total = 4 + 1 + int(data[4]) + 2
+	default:
+		return 0, false, fmt.Errorf("地址类型不支持: 0x%02x", data[3])
+	}
+
+	return total, len(data) >= total, nil
+}
@@ -0,0 +1,381 @@
+package interceptor
+
+import "testing"
+
+// handshakeStep 一个数据段及其处理后期望的阶段
+type handshakeStep struct {
+	dir   Direction
+	data  []byte
+	phase SOCKS5Phase
+}
+
+// 客户端 -> 代理 / 代理 -> 客户端 的数据段
+func c2p(phase SOCKS5Phase, data ...byte) handshakeStep {
+	return handshakeStep{dir: DirectionClientToProxy, data: data, phase: phase}
+}
+
+func p2c(phase SOCKS5Phase, data ...byte) handshakeStep {
+	return handshakeStep{dir: DirectionProxyToClient, data: data, phase: phase}
+}
+
+// join 拼接多个报文，模拟一个数据段携带多个报文
+func join(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestSOCKS5StateMachine(t *testing.T) {
+	var (
+		greetingUserPass = []byte{5, 1, 2}
+		greetingNoAuth   = []byte{5, 1, 0}
+		auth             = []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 6, 's', 'e', 'c', 'r', 'e', 't'}
+		request          = []byte{5, 1, 0, 1, 93, 184, 216, 34, 1, 187}
+		reply            = []byte{5, 0, 0, 1, 10, 0, 0, 9, 0x9c, 0x40}
+	)
+
+	cases := []struct {
+		name       string
+		steps      []handshakeStep
+		outcome    HandshakeOutcome
+		authResult AuthResult
+		username   string
+	}{
+		{
+			name: "no auth",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, reply...),
+			},
+			outcome: OutcomeSuccess,
+		},
+		{
+			name: "username password",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseSubNegotiation, 5, 2),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseRequest, 1, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, reply...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "split greeting",
+			steps: []handshakeStep{
+				c2p(PhaseGreeting, 5),
+				c2p(PhaseGreeting, 2),
+				c2p(PhaseGreeting, 0),
+				c2p(PhaseMethodSelection, 2),
+				p2c(PhaseSubNegotiation, 5, 2),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseRequest, 1, 0),
+			},
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "split replies",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseMethodSelection, 5),
+				p2c(PhaseSubNegotiation, 2),
+				c2p(PhaseSubNegotiation, auth[:4]...),
+				c2p(PhaseSubNegotiation, auth[4:]...),
+				p2c(PhaseSubNegotiation, 1),
+				p2c(PhaseRequest, 0),
+				c2p(PhaseRequest, request[:5]...),
+				c2p(PhaseReply, request[5:]...),
+				p2c(PhaseReply, reply[:6]...),
+				p2c(PhaseEstablished, reply[6:]...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "replies in one segment",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseSubNegotiation, 5, 2),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseRequest, 1, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, join(reply, []byte("HTTP/1.1 200 OK"))...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "proxy replies unobserved",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				c2p(PhaseSubNegotiation, auth...),
+				c2p(PhaseReply, request...),
+				c2p(PhaseEstablished, 'G', 'E', 'T'),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultInferred,
+			username:   "alice",
+		},
+		{
+			name: "proxy replies late",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseSubNegotiation, 5, 2),
+				p2c(PhaseRequest, 1, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, reply...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "request before late proxy replies",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				c2p(PhaseSubNegotiation, auth...),
+				c2p(PhaseReply, request...),
+				p2c(PhaseReply, 5, 2),
+				p2c(PhaseReply, 1, 0),
+				p2c(PhaseEstablished, reply...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "late proxy replies in one segment",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				c2p(PhaseSubNegotiation, auth...),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, join([]byte{5, 2, 1, 0}, reply)...),
+			},
+			outcome:    OutcomeSuccess,
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "late auth rejection",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				c2p(PhaseSubNegotiation, auth...),
+				c2p(PhaseReply, request...),
+				p2c(PhaseReply, 5, 2),
+				p2c(PhaseFailed, 1, 1),
+			},
+			outcome:    OutcomeAuthFailure,
+			authResult: AuthResultFailure,
+			username:   "alice",
+		},
+		{
+			name: "late method selection contradicts inference",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, 5, 2, 0, 2),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseFailed, 5, 0),
+			},
+			outcome:    OutcomeProtocolError,
+			authResult: AuthResultPending,
+			username:   "alice",
+		},
+		{
+			name: "client data before reply once proxy traffic seen",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseReply, request...),
+				c2p(PhaseReply, 'G', 'E', 'T'),
+				p2c(PhaseEstablished, reply...),
+			},
+			outcome: OutcomeSuccess,
+		},
+		{
+			name: "capture starts at sub-negotiation",
+			steps: []handshakeStep{
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseRequest, 1, 0),
+			},
+			authResult: AuthResultSuccess,
+			username:   "alice",
+		},
+		{
+			name: "auth rejected",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseSubNegotiation, 5, 2),
+				c2p(PhaseSubNegotiation, auth...),
+				p2c(PhaseFailed, 1, 1),
+			},
+			outcome:    OutcomeAuthFailure,
+			authResult: AuthResultFailure,
+			username:   "alice",
+		},
+		{
+			name: "no acceptable methods",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseFailed, 5, 0xFF),
+			},
+			outcome: OutcomeMethodRejected,
+		},
+		{
+			name: "unsupported method",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, 5, 1, 3),
+				p2c(PhaseFailed, 5, 3),
+			},
+			outcome: OutcomeMethodRejected,
+		},
+		{
+			name: "bad sub-negotiation version",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingUserPass...),
+				p2c(PhaseSubNegotiation, 5, 2),
+				c2p(PhaseFailed, 2, 1, 'a', 1, 'b'),
+			},
+			outcome: OutcomeProtocolError,
+		},
+		{
+			name:    "greeting without methods",
+			steps:   []handshakeStep{c2p(PhaseFailed, 5, 0)},
+			outcome: OutcomeProtocolError,
+		},
+		{
+			name: "bad method selection version",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseFailed, 4, 0),
+			},
+			outcome: OutcomeProtocolError,
+		},
+		{
+			name: "unsupported request address type",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseFailed, 5, 1, 0, 2, 1, 2, 3, 4, 0, 80),
+			},
+			outcome: OutcomeProtocolError,
+		},
+		{
+			name: "connect refused",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseFailed, 5, 5, 0, 1, 0, 0, 0, 0, 0, 0),
+			},
+			outcome: OutcomeReplyError,
+		},
+		{
+			name:    "client buffer overflow",
+			steps:   []handshakeStep{c2p(PhaseFailed, join(greetingNoAuth, make([]byte, maxDirectionBuffer))...)},
+			outcome: OutcomeBufferOverflow,
+		},
+		{
+			name: "proxy buffer overflow",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseReply, reply[:4]...),
+				p2c(PhaseFailed, make([]byte, maxDirectionBuffer-3)...),
+				p2c(PhaseFailed, reply[4:]...),
+			},
+			outcome: OutcomeBufferOverflow,
+		},
+		{
+			name: "buffer at limit",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, join([]byte{5, 0}, make([]byte, maxDirectionBuffer-2))...),
+			},
+		},
+		{
+			name: "terminal phase ignores later data",
+			steps: []handshakeStep{
+				c2p(PhaseMethodSelection, greetingNoAuth...),
+				p2c(PhaseRequest, 5, 0),
+				c2p(PhaseReply, request...),
+				p2c(PhaseEstablished, reply...),
+				c2p(PhaseEstablished, 5, 1, 2),
+				p2c(PhaseEstablished, 0xFF, 0xFF),
+			},
+			outcome: OutcomeSuccess,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTestMonitor()
+			for i, step := range tc.steps {
+				if step.dir == DirectionClientToProxy {
+					m.AnalyzePacket(step.dir, step.data, "10.0.1.1", "10.0.0.9", 40000, 1080)
+				} else {
+					m.AnalyzePacket(step.dir, step.data, "10.0.0.9", "10.0.1.1", 1080, 40000)
+				}
+				sessions := m.Sessions()
+				if len(sessions) != 1 {
+					t.Fatalf("step %d: Sessions() = %d, want 1", i, len(sessions))
+				}
+				if got := sessions[0].Phase; got != step.phase {
+					t.Fatalf("step %d (%s % x): phase = %s, want %s", i, step.dir, step.data, got, step.phase)
+				}
+			}
+
+			s := m.Sessions()[0]
+			if s.Outcome != tc.outcome {
+				t.Errorf("Outcome = %q, want %q", s.Outcome, tc.outcome)
+			}
+			if s.AuthResult != tc.authResult {
+				t.Errorf("AuthResult = %q, want %q", s.AuthResult, tc.authResult)
+			}
+			if s.Username != tc.username {
+				t.Errorf("Username = %q, want %q", s.Username, tc.username)
+			}
+		})
+	}
+}
+
+// TestNonSOCKS5GreetingNotScanned SYN建立的会话首个数据不是SOCKS5问候时直接失败，其中形似子协商的字节不作为凭据提取
+func TestNonSOCKS5GreetingNotScanned(t *testing.T) {
+	const isn = 1000
+	var events []SessionEventType
+	m := newTestMonitor()
+	m.SetEventSink(EventSinkFunc(func(event SessionEvent) { events = append(events, event.Type) }))
+
+	syn := segment(DirectionClientToProxy, isn, nil)
+	syn.Type, syn.TCPFlags = SOCKS5EventFlow, tcpFlagSYN
+	m.HandleAuthEvent(syn)
+	auth := []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 6, 's', 'e', 'c', 'r', 'e', 't'}
+	m.HandleAuthEvent(segment(DirectionClientToProxy, isn+1, join([]byte("GET "), auth)))
+
+	sessions := m.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %d, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.Phase != PhaseFailed || s.Outcome != OutcomeProtocolError {
+		t.Errorf("phase %s outcome %s, want failed protocol_error", s.Phase, s.Outcome)
+	}
+	if s.Username != "" || s.Password != "" {
+		t.Errorf("credentials = %q/%q, want none", s.Username, s.Password)
+	}
+	for _, typ := range events {
+		if typ == EventAuthenticated {
+			t.Errorf("events = %v, want no %s", events, EventAuthenticated)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package interceptor
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// 重组缓冲上限：乱序到达、等待前面数据的字节
+const (
+	maxFlowReassemblyBytes   = 16 * 1024 // 单个流单方向
+	maxGlobalReassemblyBytes = 4 << 20   // 所有流合计
+)
+
+// seqDiff 按TCP序列号回绕规则比较，a 在 b 之后时为正
+func seqDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// reassemblyStats 重组统计，所有流共享
+type reassemblyStats struct {
+	buffered    atomic.Int64  // 当前暂存的乱序字节
+	retransmits atomic.Uint64 // 丢弃的重传段
+	outOfOrder  atomic.Uint64 // 暂存过的乱序段
+	gaps        atomic.Uint64 // 因缓冲超限或内核截断而跳过的缺口
+}
+
+// ReassemblyStats TCP重组统计快照
+type ReassemblyStats struct {
+	BufferedBytes int64
+	Retransmits   uint64
+	OutOfOrder    uint64
+	Gaps          uint64
+}
+
+// reserve 申请全局缓冲额度
+func (s *reassemblyStats) reserve(n int) bool {
+	if s.buffered.Add(int64(n)) > maxGlobalReassemblyBytes {
+		s.buffered.Add(-int64(n))
+		return false
+	}
+	return true
+}
+
+// snapshot 返回统计快照
+func (s *reassemblyStats) snapshot() ReassemblyStats {
+	return ReassemblyStats{
+		BufferedBytes: s.buffered.Load(),
+		Retransmits:   s.retransmits.Load(),
+		OutOfOrder:    s.outOfOrder.Load(),
+		Gaps:          s.gaps.Load(),
+	}
+}
+
+// tcpSegment 等待前面数据的乱序段，end 为段结束的序列号（可能超出 data，表示内核截断）
+type tcpSegment struct {
+	seq  uint32
+	end  uint32
+	data []byte
+}
+
+// streamReassembler 单方向的TCP字节流重组器（调用方需持有分片锁）
+// 按序列号排序、丢弃重传和重叠部分，只输出连续的字节
+type streamReassembler struct {
+	stats        *reassemblyStats
+	started      bool
+	nextSeq      uint32       // 下一个期望的序列号
+	pending      []tcpSegment // 按 seq 排序
+	pendingBytes int
+}
+
+// newStreamReassembler 创建重组器
+func newStreamReassembler(stats *reassemblyStats) *streamReassembler {
+	return &streamReassembler{stats: stats}
+}
+
+// Start 指定流的起始序列号（SYN的序列号+1），未指定时以第一个数据段为起点
+func (r *streamReassembler) Start(seq uint32) {
+	r.started = true
+	r.nextSeq = seq
+}
+
+// Push 加入一个数据段，返回新的连续字节；gap 表示数据流出现无法补齐的缺口，
+// 返回的数据位于缺口之后，与之前的数据不连续
+// segLen 为段的完整负载长度，内核只复制了前 len(data) 字节时 segLen 更大
+func (r *streamReassembler) Push(seq uint32, data []byte, segLen uint32) (out []byte, gap bool) {
+	if segLen < uint32(len(data)) {
+		segLen = uint32(len(data))
+	}
+	if segLen == 0 {
+		return nil, false
+	}
+	end := seq + segLen
+
+	// 第一个观察到的数据段确定流的起点
+	if !r.started {
+		r.started = true
+		r.nextSeq = seq
+	}
+
+	// 完全重复的重传段
+	if seqDiff(end, r.nextSeq) <= 0 {
+		r.stats.retransmits.Add(1)
+		return nil, false
+	}
+
+	seg := tcpSegment{seq: seq, end: end, data: data}
+	if seqDiff(seq, r.nextSeq) > 0 {
+		if r.buffer(seg) {
+			return nil, false
+		}
+		// 缓冲超限，放弃等待缺失的数据
+		r.stats.gaps.Add(1)
+		return r.flush(seg), true
+	}
+
+	out, gap = r.appendSegment(nil, seg)
+	out, drainGap := r.drain(out)
+	return out, gap || drainGap
+}
+
+// flush 跳过所有缺口，按序输出暂存段和 seg
+func (r *streamReassembler) flush(seg tcpSegment) []byte {
+	segs := append(r.pending, seg)
+	r.Release()
+	sort.SliceStable(segs, func(i, j int) bool { return seqDiff(segs[i].seq, segs[j].seq) < 0 })
+
+	var out []byte
+	for _, s := range segs {
+		if seqDiff(s.seq, r.nextSeq) > 0 {
+			r.nextSeq = s.seq
+		}
+		out, _ = r.appendSegment(out, s)
+	}
+	return out
+}
+
+// appendSegment 追加与 nextSeq 相接或重叠的段，跳过已输出的部分
+func (r *streamReassembler) appendSegment(out []byte, seg tcpSegment) ([]byte, bool) {
+	if seqDiff(seg.end, r.nextSeq) <= 0 {
+		r.stats.retransmits.Add(1)
+		return out, false
+	}
+
+	skip := int(seqDiff(r.nextSeq, seg.seq))
+	if skip < len(seg.data) {
+		out = append(out, seg.data[skip:]...)
+	}
+	r.nextSeq = seg.end
+
+	// 内核只复制了段的前半部分，剩余字节永久缺失
+	truncated := seqDiff(seg.end, seg.seq) > int32(len(seg.data))
+	if truncated {
+		r.stats.gaps.Add(1)
+	}
+	return out, truncated
+}
+
+// drain 输出暂存段中已经连续的部分
+func (r *streamReassembler) drain(out []byte) ([]byte, bool) {
+	gap := false
+	for len(r.pending) > 0 && seqDiff(r.pending[0].seq, r.nextSeq) <= 0 {
+		seg := r.pending[0]
+		r.pending = r.pending[1:]
+		r.pendingBytes -= len(seg.data)
+		r.stats.buffered.Add(-int64(len(seg.data)))
+
+		var truncated bool
+		out, truncated = r.appendSegment(out, seg)
+		gap = gap || truncated
+	}
+	if len(r.pending) == 0 {
+		r.pending = nil
+	}
+	return out, gap
+}
+
+// buffer 暂存乱序段，同一序列号的重传只保留一份
+func (r *streamReassembler) buffer(seg tcpSegment) bool {
+	i := sort.Search(len(r.pending), func(i int) bool { return seqDiff(r.pending[i].seq, seg.seq) >= 0 })
+	if i < len(r.pending) && r.pending[i].seq == seg.seq && seqDiff(r.pending[i].end, seg.end) >= 0 {
+		r.stats.retransmits.Add(1)
+		return true
+	}
+
+	if r.pendingBytes+len(seg.data) > maxFlowReassemblyBytes || !r.stats.reserve(len(seg.data)) {
+		return false
+	}
+
+	seg.data = append([]byte(nil), seg.data...)
+	r.pending = append(r.pending, tcpSegment{})
+	copy(r.pending[i+1:], r.pending[i:])
+	r.pending[i] = seg
+	r.pendingBytes += len(seg.data)
+	r.stats.outOfOrder.Add(1)
+	return true
+}
+
+// Release 释放暂存的乱序段
+func (r *streamReassembler) Release() {
+	r.stats.buffered.Add(-int64(r.pendingBytes))
+	r.pending = nil
+	r.pendingBytes = 0
+}
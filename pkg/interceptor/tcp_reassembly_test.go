@@ -0,0 +1,278 @@
+package interceptor
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// testSegment 输入重组器的一个数据段，segLen 为 0 时取 len(data)
+type testSegment struct {
+	seq    uint32
+	data   string
+	segLen uint32
+}
+
+// pushResult 一次 Push 的期望输出
+type pushResult struct {
+	out string
+	gap bool
+}
+
+func TestStreamReassembler(t *testing.T) {
+	const wrap = 0xFFFFFFFC // 距回绕还有4个字节
+
+	cases := []struct {
+		name     string
+		start    *uint32 // 为空时以第一个数据段为起点
+		segments []testSegment
+		want     []pushResult
+		stats    ReassemblyStats
+	}{
+		{
+			name:     "in order",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 103, data: "def"}},
+			want:     []pushResult{{out: "abc"}, {out: "def"}},
+		},
+		{
+			name:     "out of order",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 106, data: "ghi"}, {seq: 103, data: "def"}},
+			want:     []pushResult{{out: "abc"}, {}, {out: "defghi"}},
+			stats:    ReassemblyStats{OutOfOrder: 1},
+		},
+		{
+			name:     "reverse order after start",
+			start:    u32(100),
+			segments: []testSegment{{seq: 106, data: "ghi"}, {seq: 103, data: "def"}, {seq: 100, data: "abc"}},
+			want:     []pushResult{{}, {}, {out: "abcdefghi"}},
+			stats:    ReassemblyStats{OutOfOrder: 2},
+		},
+		{
+			name:     "full retransmit",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 100, data: "abc"}, {seq: 103, data: "def"}},
+			want:     []pushResult{{out: "abc"}, {}, {out: "def"}},
+			stats:    ReassemblyStats{Retransmits: 1},
+		},
+		{
+			name:     "overlapping retransmit",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 101, data: "bcde"}},
+			want:     []pushResult{{out: "abc"}, {out: "de"}},
+		},
+		{
+			name:     "retransmit of buffered segment",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 106, data: "ghi"}, {seq: 106, data: "ghi"}, {seq: 103, data: "def"}},
+			want:     []pushResult{{out: "abc"}, {}, {}, {out: "defghi"}},
+			stats:    ReassemblyStats{OutOfOrder: 1, Retransmits: 1},
+		},
+		{
+			name:     "truncated segment leaves gap",
+			segments: []testSegment{{seq: 100, data: "ab", segLen: 5}, {seq: 105, data: "fg"}},
+			want:     []pushResult{{out: "ab", gap: true}, {out: "fg"}},
+			stats:    ReassemblyStats{Gaps: 1},
+		},
+		{
+			name:     "truncated segment drained from buffer",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 106, data: "gh", segLen: 4}, {seq: 103, data: "def"}, {seq: 110, data: "k"}},
+			want:     []pushResult{{out: "abc"}, {}, {out: "defgh", gap: true}, {out: "k"}},
+			stats:    ReassemblyStats{OutOfOrder: 1, Gaps: 1},
+		},
+		{
+			name:     "empty segment",
+			segments: []testSegment{{seq: 100, data: "abc"}, {seq: 103}},
+			want:     []pushResult{{out: "abc"}, {}},
+		},
+		{
+			name:     "sequence wraparound in order",
+			segments: []testSegment{{seq: wrap, data: "abcd"}, {seq: 0, data: "efg"}},
+			want:     []pushResult{{out: "abcd"}, {out: "efg"}},
+		},
+		{
+			name:     "segment spanning wraparound",
+			segments: []testSegment{{seq: wrap - 2, data: "ab"}, {seq: wrap, data: "cdefgh"}, {seq: 2, data: "ij"}},
+			want:     []pushResult{{out: "ab"}, {out: "cdefgh"}, {out: "ij"}},
+		},
+		{
+			name:     "out of order across wraparound",
+			segments: []testSegment{{seq: wrap, data: "ab"}, {seq: 2, data: "ghi"}, {seq: wrap + 2, data: "cdef"}},
+			want:     []pushResult{{out: "ab"}, {}, {out: "cdefghi"}},
+			stats:    ReassemblyStats{OutOfOrder: 1},
+		},
+		{
+			name:     "retransmit before wraparound",
+			segments: []testSegment{{seq: wrap, data: "abcd"}, {seq: 0, data: "ef"}, {seq: wrap, data: "abcd"}},
+			want:     []pushResult{{out: "abcd"}, {out: "ef"}, {}},
+			stats:    ReassemblyStats{Retransmits: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := &reassemblyStats{}
+			r := newStreamReassembler(stats)
+			if tc.start != nil {
+				r.Start(*tc.start)
+			}
+			for i, seg := range tc.segments {
+				out, gap := r.Push(seg.seq, []byte(seg.data), seg.segLen)
+				want := tc.want[i]
+				if string(out) != want.out || gap != want.gap {
+					t.Errorf("Push #%d (seq %d) = %q, gap %v; want %q, gap %v", i, seg.seq, out, gap, want.out, want.gap)
+				}
+			}
+			r.Release()
+			if got := stats.snapshot(); got != tc.stats {
+				t.Errorf("stats = %+v, want %+v", got, tc.stats)
+			}
+		})
+	}
+}
+
+func TestStreamReassemblerBufferLimit(t *testing.T) {
+	stats := &reassemblyStats{}
+	r := newStreamReassembler(stats)
+	r.Start(0)
+
+	// 缺少 seq 0 的段，乱序段填满单流缓冲后放弃等待
+	chunk := bytes.Repeat([]byte{'x'}, 1024)
+	seq := uint32(1)
+	for i := 0; i < maxFlowReassemblyBytes/len(chunk); i++ {
+		if out, gap := r.Push(seq, chunk, 0); out != nil || gap {
+			t.Fatalf("Push #%d = %d bytes, gap %v; want buffered", i, len(out), gap)
+		}
+		seq += uint32(len(chunk))
+	}
+	if got := stats.snapshot().BufferedBytes; got != maxFlowReassemblyBytes {
+		t.Fatalf("BufferedBytes = %d, want %d", got, maxFlowReassemblyBytes)
+	}
+
+	out, gap := r.Push(seq, []byte("tail"), 0)
+	if !gap {
+		t.Error("gap = false, want true when the buffer overflows")
+	}
+	if want := maxFlowReassemblyBytes + len("tail"); len(out) != want {
+		t.Errorf("flushed %d bytes, want %d", len(out), want)
+	}
+	got := stats.snapshot()
+	if got.BufferedBytes != 0 || got.Gaps != 1 {
+		t.Errorf("stats = %+v, want no buffered bytes and 1 gap", got)
+	}
+
+	// 缺口之后继续按序输出
+	if out, gap := r.Push(seq+4, []byte("more"), 0); string(out) != "more" || gap {
+		t.Errorf("Push after flush = %q, gap %v; want %q", out, gap, "more")
+	}
+}
+
+func TestSeqDiff(t *testing.T) {
+	cases := []struct {
+		a, b uint32
+		want int32
+	}{
+		{10, 5, 5},
+		{5, 10, -5},
+		{0, 0xFFFFFFFF, 1},
+		{0xFFFFFFFF, 0, -1},
+		{3, 0xFFFFFFFE, 5},
+	}
+	for _, tc := range cases {
+		if got := seqDiff(tc.a, tc.b); got != tc.want {
+			t.Errorf("seqDiff(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func u32(v uint32) *uint32 {
+	return &v
+}
+
+// segment 10.0.1.1:40000 与代理 10.0.0.9:1080 之间的一个数据段
+func segment(dir Direction, seq uint32, payload []byte) *SOCKS5AuthEvent {
+	event := &SOCKS5AuthEvent{Type: SOCKS5EventSegment, Direction: dir, SrcIP: net.ParseIP("10.0.1.1"), DstIP: net.ParseIP("10.0.0.9"),
+		SrcPort: 40000, DstPort: 1080, Seq: seq, SegLen: uint32(len(payload)), Payload: payload}
+	if dir == DirectionProxyToClient {
+		event.SrcIP, event.DstIP = event.DstIP, event.SrcIP
+		event.SrcPort, event.DstPort = event.DstPort, event.SrcPort
+	}
+	return event
+}
+
+// TestReassembledHandshake 乱序、重传的内核数据段经重组后仍能完整解析握手
+func TestReassembledHandshake(t *testing.T) {
+	const isn = 0xFFFFFFF0 // 客户端方向的序列号在握手中途回绕
+	greeting := []byte{5, 1, 2}
+	auth := []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 6, 's', 'e', 'c', 'r', 'e', 't'}
+	request := []byte{5, 1, 0, 3, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 1, 187}
+
+	m := newTestMonitor()
+	authSeq := uint32(isn + len(greeting))
+	requestSeq := authSeq + uint32(len(auth))
+	for _, event := range []*SOCKS5AuthEvent{
+		segment(DirectionClientToProxy, isn, greeting),
+		segment(DirectionProxyToClient, 5000, []byte{5, 2}),
+		// 凭据的后半段先到，前半段随后到达，再重传一次
+		segment(DirectionClientToProxy, authSeq+7, auth[7:]),
+		segment(DirectionClientToProxy, authSeq, auth[:7]),
+		segment(DirectionClientToProxy, authSeq, auth[:7]),
+		segment(DirectionProxyToClient, 5002, []byte{1, 0}),
+		segment(DirectionClientToProxy, requestSeq, request),
+		segment(DirectionProxyToClient, 5004, []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}),
+	} {
+		m.HandleAuthEvent(event)
+	}
+
+	sessions := m.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %d, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.Phase != PhaseEstablished || s.Username != "alice" || s.Password != "secret" {
+		t.Errorf("session phase %s credentials %q/%q, want established alice/secret", s.Phase, s.Username, s.Password)
+	}
+	if s.TargetHost != "example.com" || s.TargetPort != 443 {
+		t.Errorf("target = %s:%d, want example.com:443", s.TargetHost, s.TargetPort)
+	}
+	if stats := m.ReassemblyStats(); stats.OutOfOrder != 1 || stats.Retransmits != 1 || stats.BufferedBytes != 0 {
+		t.Errorf("ReassemblyStats() = %+v, want 1 out-of-order, 1 retransmit, 0 buffered", stats)
+	}
+}
+
+// TestReassembledServerStreamFromSYNACK 代理方向以 SYN-ACK 的序列号为起点，第一个数据段乱序到达时被缓冲而不是作为起点
+func TestReassembledServerStreamFromSYNACK(t *testing.T) {
+	const clientISN, proxyISN = 1000, 5000
+	flow := func(dir Direction, seq uint32, flags uint8) *SOCKS5AuthEvent {
+		event := segment(dir, seq, nil)
+		event.Type, event.TCPFlags = SOCKS5EventFlow, flags
+		return event
+	}
+	greeting := []byte{5, 1, 2}
+	auth := []byte{1, 5, 'a', 'l', 'i', 'c', 'e', 6, 's', 'e', 'c', 'r', 'e', 't'}
+	request := []byte{5, 1, 0, 1, 1, 2, 3, 4, 0, 80}
+
+	m := newTestMonitor()
+	authSeq := uint32(clientISN + 1 + len(greeting))
+	for _, event := range []*SOCKS5AuthEvent{
+		flow(DirectionClientToProxy, clientISN, tcpFlagSYN),
+		flow(DirectionProxyToClient, proxyISN, tcpFlagSYN|tcpFlagACK),
+		segment(DirectionClientToProxy, clientISN+1, greeting),
+		segment(DirectionClientToProxy, authSeq, auth),
+		// 认证结果先于方法选择到达
+		segment(DirectionProxyToClient, proxyISN+3, []byte{1, 0}),
+		segment(DirectionProxyToClient, proxyISN+1, []byte{5, 2}),
+		segment(DirectionClientToProxy, authSeq+uint32(len(auth)), request),
+		segment(DirectionProxyToClient, proxyISN+5, []byte{5, 0, 0, 1, 1, 2, 3, 4, 0, 80}),
+	} {
+		m.HandleAuthEvent(event)
+	}
+
+	sessions := m.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Sessions() = %d, want 1", len(sessions))
+	}
+	s := sessions[0]
+	if s.Phase != PhaseEstablished || s.AuthResult != AuthResultSuccess || s.Username != "alice" {
+		t.Errorf("session phase %s auth %s user %q (%s), want established success alice", s.Phase, s.AuthResult, s.Username, s.StopReason)
+	}
+	if stats := m.ReassemblyStats(); stats.OutOfOrder != 1 || stats.BufferedBytes != 0 {
+		t.Errorf("ReassemblyStats() = %+v, want 1 out-of-order, 0 buffered", stats)
+	}
+}
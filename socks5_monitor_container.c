@@ -1,12 +1,15 @@
 #include <linux/bpf.h>
 #include <linux/if_ether.h>
 #include <linux/ip.h>
+#include <linux/ipv6.h>
 #include <linux/tcp.h>
 #include <linux/in.h>
+#include <linux/in6.h>
 #include <linux/pkt_cls.h>
 #include <linux/version.h>
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_endian.h>
+#include <bpf/bpf_tracing.h>
 
 // 兼容性定义
 #ifndef TC_ACT_OK
@@ -20,18 +23,150 @@
 // 容器内eBPF监控 - 专门用于容器内流量监控
 // 编译标志：-D CONTAINER_MODE=1
 
+// 事件类型
+#define SOCKS5_EVENT_AUTH    1 // 客户端RFC 1929用户名密码认证
+#define SOCKS5_EVENT_SEGMENT 2 // 握手阶段原始报文（问候、方法选择、认证结果、请求、应答）
+#define SOCKS5_EVENT_FLOW    3 // TCP连接建立或关闭（SYN、FIN、RST）
+
+// TCP标志位（TCP头第13字节）
+#define TCP_FLAG_FIN 0x01
+#define TCP_FLAG_SYN 0x02
+#define TCP_FLAG_RST 0x04
+#define TCP_FLAG_ACK 0x10
+
+// socks5_flows 中的流状态
+#define FLOW_SOCKS5      0x01 // 客户端已发送SOCKS5报文
+#define FLOW_FIN_CLIENT  0x02 // 客户端已发送FIN
+#define FLOW_FIN_PROXY   0x04 // 代理已发送FIN
+#define FLOW_SYNACK      0x08 // 已上报代理的SYN-ACK
+
+// 报文方向
+#define DIR_EGRESS  0 // 客户端 -> 代理
+#define DIR_INGRESS 1 // 代理 -> 客户端
+
+// RFC 1929 用户名、密码最大长度
+#define SOCKS5_CRED_MAX 255
+
+// 握手报文最多复制的字节数：最长的请求为 4 + 1 + 255 + 2 = 262 字节
+#define SOCKS5_SEGMENT_MAX 264
+
+// 每个流上报的握手字节上限（双向合计），超过后视为进入数据转发阶段不再上报
+#define SOCKS5_HANDSHAKE_BYTES 2048
+
+// 截断标志
+#define TRUNC_USERNAME 0x01 // 用户名未完整出现在当前数据包中
+#define TRUNC_PASSWORD 0x02 // 密码未完整出现在当前数据包中
+#define TRUNC_PAYLOAD  0x04 // 握手报文超过 SOCKS5_SEGMENT_MAX
+
+// 进程名长度（TASK_COMM_LEN）
+#define TASK_COMM_LEN 16
+
+// IPv6扩展头最多跳过的个数
+#define IPV6_EXT_MAX 6
+
+// IPv6分片扩展头
+struct ipv6_frag_hdr {
+    __u8 nexthdr;
+    __u8 reserved;
+    __be16 frag_off;
+    __be32 identification;
+};
+
+// 数据包的地址和负载位置，IPv4地址以IPv4映射IPv6形式(::ffff:a.b.c.d)保存，网络字节序
+struct flow_info {
+    __u8 src_addr[16];
+    __u8 dst_addr[16];
+    __u16 src_port;
+    __u16 dst_port;
+    __u32 l4_off;      // TCP头偏移
+    __u32 payload_off; // TCP负载偏移
+    __u32 payload_len; // TCP负载长度（包含非线性区）
+    __u32 seq;         // TCP序列号，主机字节序
+    __u8 tcp_flags;    // TCP标志位
+};
+
+// 代理地址（与用户空间 proxyEndpointKey 一致）
+struct proxy_endpoint {
+    __u8 addr[16];
+    __u16 port;
+    __u16 pad;
+};
+
+// 会话映射的键
+struct session_key {
+    __u8 src_addr[16];
+    __u16 src_port;
+    __u16 dst_port;
+};
+
 // SOCKS5认证信息结构
 struct socks5_auth_event {
     __u32 pid;
-    __u32 src_ip;
-    __u32 dst_ip;
+    __u8 src_addr[16];
+    __u8 dst_addr[16];
     __u16 src_port;
     __u16 dst_port;
-    __u8 username[64];
-    __u8 password[64];
-    __u8 username_len;
-    __u8 password_len;
+    __u8 username[SOCKS5_CRED_MAX + 1];
+    __u8 password[SOCKS5_CRED_MAX + 1];
+    __u8 username_len; // 协议中声明的长度
+    __u8 password_len; // 协议中声明的长度
+    __u8 event_type;
+    __u8 direction;
+    __u16 payload_len;
+    __u8 truncated;    // TRUNC_* 标志
+    __u8 pad;
+    __u8 payload[SOCKS5_SEGMENT_MAX];
     __u64 timestamp;
+    __u64 cookie;              // socket cookie，入站数据包通常没有关联socket，为0
+    char comm[TASK_COMM_LEN];  // 发起连接的进程名，未知时为空
+    __u32 seq;                 // 数据段首字节的TCP序列号
+    __u32 seg_len;             // 数据段的完整TCP负载长度，可能大于实际复制的字节数
+    __u8 tcp_flags;            // TCP标志位
+    __u8 pad2[7];
+    // 以下仅 SOCKS5_EVENT_FLOW 关闭事件填写：连接关闭时的流量计数
+    __u64 bytes_up;
+    __u64 bytes_down;
+    __u64 packets_up;
+    __u64 packets_down;
+};
+
+// 代理连接的状态，用户空间按键查询活跃时间和流量计数
+struct flow_state {
+    __u64 last_seen;    // 最后一个数据包的 bpf_ktime_get_ns()
+    __u64 bytes_up;     // 客户端 -> 代理 的TCP负载字节（从首个SOCKS5报文开始）
+    __u64 bytes_down;   // 代理 -> 客户端 的TCP负载字节
+    __u64 packets_up;   // 客户端 -> 代理 携带负载的数据包
+    __u64 packets_down; // 代理 -> 客户端 携带负载的数据包
+    __u32 sent;         // 已上报的握手字节数
+    __u8 flags;         // FLOW_* 标志
+    __u8 pad[3];
+};
+
+// 内核 struct sock，fentry 参数只作为指针使用
+struct sock;
+
+// tracepoint/sched/sched_process_fork 参数
+struct sched_process_fork_args {
+    __u64 common;
+    char parent_comm[TASK_COMM_LEN];
+    __s32 parent_pid;
+    char child_comm[TASK_COMM_LEN];
+    __s32 child_pid;
+};
+
+// tracepoint/sched/sched_process_exec 参数
+struct sched_process_exec_args {
+    __u64 common;
+    __u32 filename_loc;
+    __s32 pid;
+    __s32 old_pid;
+};
+
+// socket 所属进程，在进程上下文中（connect/sendmsg）记录
+struct socket_owner {
+    __u32 tgid;
+    __u32 pid;
+    char comm[TASK_COMM_LEN];
 };
 
 // 定义eBPF映射 - 用于与用户空间通信
@@ -45,122 +180,594 @@ struct {
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
     __uint(max_entries, 1024);
-    __uint(key_size, sizeof(__u64));
+    __uint(key_size, sizeof(struct session_key));
     __uint(value_size, sizeof(struct socks5_auth_event));
 } socks5_sessions SEC(".maps");
 
-// 容器内网络流量监控 - TC (Traffic Control) 钩子
-SEC("tc")
-int container_traffic_monitor(struct __sk_buff *skb)
+// 需要监控的SOCKS5端口（任意地址），由用户空间在启动和运行时写入
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, __u16);
+    __type(value, __u8);
+} socks5_ports SEC(".maps");
+
+// 需要监控的SOCKS5代理 IP:端口，由用户空间在启动和运行时写入
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 256);
+    __type(key, struct proxy_endpoint);
+    __type(value, __u8);
+} socks5_proxies SEC(".maps");
+
+// 代理连接（键为客户端地址、端口和代理端口）-> 流状态
+// 由客户端SYN或首个SOCKS5报文创建，握手阶段的所有数据段都上报，供用户空间按序列号重组；
+// RST 或双向FIN后删除
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 8192);
+    __type(key, struct session_key);
+    __type(value, struct flow_state);
+} socks5_flows SEC(".maps");
+
+// socket cookie -> 所属进程，TC中的当前任务与数据包无关，必须按cookie关联
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 16384);
+    __type(key, __u64);
+    __type(value, struct socket_owner);
+} socket_owners SEC(".maps");
+
+// 受监控进程树（linuxService 及其所有子孙进程）的TGID，由fork/exec/exit跟踪点维护
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 4096);
+    __type(key, __u32);
+    __type(value, __u8);
+} supervised_tgids SEC(".maps");
+
+// 进程过滤配置：键0为受监控进程树的根TGID，0表示不过滤
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, __u32);
+} process_filter SEC(".maps");
+
+// 事件构造缓冲区，socks5_auth_event 超过BPF栈上限(512字节)
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct socks5_auth_event);
+} event_scratch SEC(".maps");
+
+// is_socks5_proxy 检查代理地址和端口是否在监控范围内
+static __always_inline int is_socks5_proxy(__u8 *addr, __u16 port)
 {
-    // 解析以太网头
-    void *data = (void *)(long)skb->data;
-    void *data_end = (void *)(long)skb->data_end;
+    if (bpf_map_lookup_elem(&socks5_ports, &port))
+        return 1;
     
-    struct ethhdr *eth = data;
-    if ((void *)(eth + 1) > data_end)
-        return TC_ACT_OK;
+    struct proxy_endpoint endpoint = {};
+    __builtin_memcpy(endpoint.addr, addr, 16);
+    endpoint.port = port;
+    return bpf_map_lookup_elem(&socks5_proxies, &endpoint) != NULL;
+}
+
+// parse_ipv4 解析IPv4头，返回TCP头偏移
+static __always_inline int parse_ipv4(struct __sk_buff *skb, __u32 off, struct flow_info *flow)
+{
+    struct iphdr ip;
+    if (bpf_skb_load_bytes(skb, off, &ip, sizeof(ip)) < 0)
+        return -1;
     
-    // 只处理IP数据包
-    if (bpf_ntohs(eth->h_proto) != ETH_P_IP)
-        return TC_ACT_OK;
+    // 只处理TCP数据包，且忽略非首个分片
+    if (ip.protocol != IPPROTO_TCP || (bpf_ntohs(ip.frag_off) & 0x1fff))
+        return -1;
     
-    // 解析IP头
-    struct iphdr *ip = (void *)(eth + 1);
-    if ((void *)(ip + 1) > data_end)
-        return TC_ACT_OK;
+    flow->src_addr[10] = 0xff;
+    flow->src_addr[11] = 0xff;
+    __builtin_memcpy(&flow->src_addr[12], &ip.saddr, 4);
+    flow->dst_addr[10] = 0xff;
+    flow->dst_addr[11] = 0xff;
+    __builtin_memcpy(&flow->dst_addr[12], &ip.daddr, 4);
+    
+    return off + ip.ihl * 4;
+}
+
+// parse_ipv6 解析IPv6头并跳过扩展头，返回TCP头偏移
+static __always_inline int parse_ipv6(struct __sk_buff *skb, __u32 off, struct flow_info *flow)
+{
+    struct ipv6hdr ip6;
+    if (bpf_skb_load_bytes(skb, off, &ip6, sizeof(ip6)) < 0)
+        return -1;
+    
+    __builtin_memcpy(flow->src_addr, &ip6.saddr, 16);
+    __builtin_memcpy(flow->dst_addr, &ip6.daddr, 16);
+    
+    __u8 nexthdr = ip6.nexthdr;
+    off += sizeof(ip6);
+    
+    #pragma unroll
+    for (int i = 0; i < IPV6_EXT_MAX; i++) {
+        if (nexthdr == IPPROTO_TCP)
+            break;
+        
+        if (nexthdr == IPPROTO_HOPOPTS || nexthdr == IPPROTO_ROUTING || nexthdr == IPPROTO_DSTOPTS) {
+            struct ipv6_opt_hdr opt;
+            if (bpf_skb_load_bytes(skb, off, &opt, sizeof(opt)) < 0)
+                return -1;
+            nexthdr = opt.nexthdr;
+            off += (opt.hdrlen + 1) * 8;
+        } else if (nexthdr == IPPROTO_FRAGMENT) {
+            struct ipv6_frag_hdr frag;
+            if (bpf_skb_load_bytes(skb, off, &frag, sizeof(frag)) < 0)
+                return -1;
+            // 非首个分片不含TCP头
+            if (bpf_ntohs(frag.frag_off) & 0xfff8)
+                return -1;
+            nexthdr = frag.nexthdr;
+            off += sizeof(frag);
+        } else if (nexthdr == IPPROTO_AH) {
+            struct ipv6_opt_hdr ah;
+            if (bpf_skb_load_bytes(skb, off, &ah, sizeof(ah)) < 0)
+                return -1;
+            nexthdr = ah.nexthdr;
+            off += (ah.hdrlen + 2) * 4;
+        } else {
+            return -1;
+        }
+    }
     
     // 只处理TCP数据包
-    if (ip->protocol != IPPROTO_TCP)
-        return TC_ACT_OK;
+    if (nexthdr != IPPROTO_TCP)
+        return -1;
     
-    // 解析TCP头
-    struct tcphdr *tcp = (void *)ip + (ip->ihl * 4);
-    if ((void *)(tcp + 1) > data_end)
-        return TC_ACT_OK;
+    return off;
+}
+
+// parse_flow 从L3头开始解析到TCP负载，支持线性区之外的分页数据
+static __always_inline int parse_flow(struct __sk_buff *skb, __u32 l3_off, __u16 proto, struct flow_info *flow)
+{
+    int l4_off;
+    if (proto == ETH_P_IP)
+        l4_off = parse_ipv4(skb, l3_off, flow);
+    else if (proto == ETH_P_IPV6)
+        l4_off = parse_ipv6(skb, l3_off, flow);
+    else
+        return -1;
+    if (l4_off < 0)
+        return -1;
     
-    // 检查是否为SOCKS5端口
-    __u16 dst_port = bpf_ntohs(tcp->dest);
-    if (dst_port != 1080 && dst_port != 1081 && dst_port != 7890 && 
-        dst_port != 7891 && dst_port != 8080 && dst_port != 8081)
-        return TC_ACT_OK;
+    struct tcphdr tcp;
+    if (bpf_skb_load_bytes(skb, l4_off, &tcp, sizeof(tcp)) < 0)
+        return -1;
     
-    // 获取TCP负载
-    void *payload = (void *)tcp + (tcp->doff * 4);
-    if (payload >= data_end)
-        return TC_ACT_OK;
+    flow->src_port = bpf_ntohs(tcp.source);
+    flow->dst_port = bpf_ntohs(tcp.dest);
+    flow->l4_off = l4_off;
+    flow->payload_off = l4_off + tcp.doff * 4;
+    if (skb->len < flow->payload_off)
+        return -1;
+    flow->payload_len = skb->len - flow->payload_off;
+    flow->seq = bpf_ntohl(tcp.seq);
+    flow->tcp_flags = ((__u8 *)&tcp)[13];
+    return 0;
+}
+
+// new_event 从缓冲区取出事件并填充公共字段，进程信息按socket cookie从 socket_owners 关联
+static __always_inline struct socks5_auth_event *new_event(struct __sk_buff *skb, struct flow_info *flow, __u8 event_type, __u8 direction)
+{
+    __u32 zero = 0;
+    struct socks5_auth_event *event = bpf_map_lookup_elem(&event_scratch, &zero);
+    if (!event)
+        return NULL;
     
-    // 检查负载长度
-    int payload_len = data_end - payload;
-    if (payload_len < 3)
-        return TC_ACT_OK;
+    event->cookie = bpf_get_socket_cookie(skb);
+    struct socket_owner *owner = NULL;
+    if (event->cookie)
+        owner = bpf_map_lookup_elem(&socket_owners, &event->cookie);
+    if (owner) {
+        event->pid = owner->tgid;
+        __builtin_memcpy(event->comm, owner->comm, TASK_COMM_LEN);
+    } else {
+        event->pid = 0;
+        __builtin_memset(event->comm, 0, TASK_COMM_LEN);
+    }
     
-    // 分析SOCKS5协议
-    __u8 *data_ptr = (__u8 *)payload;
-    
-    // 检查SOCKS5用户名密码认证
-    if (payload_len >= 3 && data_ptr[0] == 0x01) {
-        // SOCKS5用户名密码认证格式：
-        // +----+------+----------+------+----------+
-        // |VER | ULEN |  UNAME   | PLEN |  PASSWD  |
-        // +----+------+----------+------+----------+
-        // | 1  |  1   | 1 to 255 |  1   | 1 to 255 |
-        // +----+------+----------+------+----------+
-        
-        __u8 username_len = data_ptr[1];
-        if (username_len > 0 && username_len < 64 && payload_len >= 2 + username_len + 1) {
-            __u8 password_len = data_ptr[2 + username_len];
-            if (password_len > 0 && password_len < 64 && 
-                payload_len >= 2 + username_len + 1 + password_len) {
-                
-                // 创建SOCKS5认证事件
-                struct socks5_auth_event event = {};
-                event.pid = bpf_get_current_pid_tgid() >> 32;
-                event.src_ip = bpf_ntohl(ip->saddr);
-                event.dst_ip = bpf_ntohl(ip->daddr);
-                event.src_port = bpf_ntohs(tcp->source);
-                event.dst_port = dst_port;
-                event.username_len = username_len;
-                event.password_len = password_len;
-                event.timestamp = bpf_ktime_get_ns();
-                
-                // 复制用户名（安全检查）
-                int i;
-                for (i = 0; i < username_len && i < 63; i++) {
-                    if ((void *)&data_ptr[2 + i + 1] > data_end)
-                        break;
-                    event.username[i] = data_ptr[2 + i];
-                }
-                event.username[i] = '\0';
-                
-                // 复制密码（安全检查）
-                for (i = 0; i < password_len && i < 63; i++) {
-                    if ((void *)&data_ptr[2 + username_len + 1 + i + 1] > data_end)
-                        break;
-                    event.password[i] = data_ptr[2 + username_len + 1 + i];
-                }
-                event.password[i] = '\0';
-                
-                // 发送事件到用户空间
-                bpf_perf_event_output(skb, &socks5_events, BPF_F_CURRENT_CPU, 
-                                    &event, sizeof(event));
-                
-                // 存储会话信息
-                __u64 session_key = ((__u64)event.src_ip << 32) | 
-                                   ((__u64)event.src_port << 16) | event.dst_port;
-                bpf_map_update_elem(&socks5_sessions, &session_key, &event, BPF_ANY);
+    __builtin_memcpy(event->src_addr, flow->src_addr, 16);
+    __builtin_memcpy(event->dst_addr, flow->dst_addr, 16);
+    event->src_port = flow->src_port;
+    event->dst_port = flow->dst_port;
+    event->username_len = 0;
+    event->password_len = 0;
+    event->event_type = event_type;
+    event->direction = direction;
+    event->payload_len = 0;
+    event->truncated = 0;
+    event->timestamp = bpf_ktime_get_ns();
+    event->seq = flow->seq;
+    event->seg_len = flow->payload_len;
+    event->tcp_flags = flow->tcp_flags;
+    return event;
+}
+
+// is_supervised_socket 检查数据包所属socket是否来自受监控进程树
+// 未启用过滤或无法确定归属（进程归属不可用、监控启动前的连接）时放行
+static __always_inline int is_supervised_socket(struct __sk_buff *skb)
+{
+    __u32 zero = 0;
+    __u32 *root = bpf_map_lookup_elem(&process_filter, &zero);
+    if (!root || *root == 0)
+        return 1;
+    
+    __u64 cookie = bpf_get_socket_cookie(skb);
+    if (!cookie)
+        return 1;
+    struct socket_owner *owner = bpf_map_lookup_elem(&socket_owners, &cookie);
+    if (!owner)
+        return 1;
+    
+    return bpf_map_lookup_elem(&supervised_tgids, &owner->tgid) != NULL;
+}
+
+// emit_segment 上报握手阶段的原始报文
+static __always_inline void emit_segment(struct __sk_buff *skb, struct flow_info *flow, __u8 direction)
+{
+    struct socks5_auth_event *event = new_event(skb, flow, SOCKS5_EVENT_SEGMENT, direction);
+    if (!event)
+        return;
+    
+    __u32 len = flow->payload_len;
+    if (len > SOCKS5_SEGMENT_MAX) {
+        len = SOCKS5_SEGMENT_MAX;
+        event->truncated |= TRUNC_PAYLOAD;
+    }
+    if (len == 0 || bpf_skb_load_bytes(skb, flow->payload_off, event->payload, len) < 0)
+        return;
+    event->payload_len = len;
+    
+    bpf_perf_event_output(skb, &socks5_events, BPF_F_CURRENT_CPU, event, sizeof(*event));
+}
+
+// load_credential 复制用户名或密码，返回实际复制的字节数，数据不足时只复制已有部分
+static __always_inline __u32 load_credential(struct __sk_buff *skb, __u32 off, __u32 avail, __u8 declared, __u8 *dst)
+{
+    __u32 len = declared;
+    if (len > avail)
+        len = avail;
+    if (len == 0 || len > SOCKS5_CRED_MAX)
+        return 0;
+    if (bpf_skb_load_bytes(skb, off, dst, len) < 0)
+        return 0;
+    return len;
+}
+
+// emit_auth 解析并上报RFC 1929用户名密码认证
+static __always_inline void emit_auth(struct __sk_buff *skb, struct flow_info *flow, __u8 direction)
+{
+    // SOCKS5用户名密码认证格式：
+    // +----+------+----------+------+----------+
+    // |VER | ULEN |  UNAME   | PLEN |  PASSWD  |
+    // +----+------+----------+------+----------+
+    // | 1  |  1   | 1 to 255 |  1   | 1 to 255 |
+    // +----+------+----------+------+----------+
+    // 不是合法的认证报文时按普通数据段上报，保持数据流完整
+    __u8 hdr[2];
+    if (flow->payload_len < 3 || bpf_skb_load_bytes(skb, flow->payload_off, hdr, sizeof(hdr)) < 0 || hdr[1] == 0) {
+        emit_segment(skb, flow, direction);
+        return;
+    }
+    
+    __u8 username_len = hdr[1];
+    
+    struct socks5_auth_event *event = new_event(skb, flow, SOCKS5_EVENT_AUTH, direction);
+    if (!event)
+        return;
+    event->username_len = username_len;
+    
+    // 复制用户名
+    __u32 avail = flow->payload_len - 2;
+    __u32 copied = load_credential(skb, flow->payload_off + 2, avail, username_len, event->username);
+    if (copied < username_len)
+        event->truncated |= TRUNC_USERNAME | TRUNC_PASSWORD;
+    
+    // 复制密码
+    __u32 plen_off = 2 + username_len;
+    __u8 password_len = 0;
+    if (copied == username_len && flow->payload_len > plen_off &&
+        bpf_skb_load_bytes(skb, flow->payload_off + plen_off, &password_len, 1) == 0) {
+        event->password_len = password_len;
+        avail = flow->payload_len - plen_off - 1;
+        copied = load_credential(skb, flow->payload_off + plen_off + 1, avail, password_len, event->password);
+        if (copied < password_len)
+            event->truncated |= TRUNC_PASSWORD;
+    } else {
+        event->truncated |= TRUNC_PASSWORD;
+    }
+    
+    // 发送事件到用户空间
+    bpf_perf_event_output(skb, &socks5_events, BPF_F_CURRENT_CPU, event, sizeof(*event));
+    
+    // 存储会话信息
+    struct session_key key = {};
+    __builtin_memcpy(key.src_addr, event->src_addr, 16);
+    key.src_port = event->src_port;
+    key.dst_port = event->dst_port;
+    bpf_map_update_elem(&socks5_sessions, &key, event, BPF_ANY);
+}
+
+// emit_flow 上报连接建立或关闭（不含负载），关闭时附带流量计数
+static __always_inline void emit_flow(struct __sk_buff *skb, struct flow_info *flow, struct flow_state *state, __u8 direction)
+{
+    struct socks5_auth_event *event = new_event(skb, flow, SOCKS5_EVENT_FLOW, direction);
+    if (!event)
+        return;
+    
+    if (state) {
+        event->bytes_up = state->bytes_up;
+        event->bytes_down = state->bytes_down;
+        event->packets_up = state->packets_up;
+        event->packets_down = state->packets_down;
+    } else {
+        event->bytes_up = 0;
+        event->bytes_down = 0;
+        event->packets_up = 0;
+        event->packets_down = 0;
+    }
+    
+    bpf_perf_event_output(skb, &socks5_events, BPF_F_CURRENT_CPU, event, sizeof(*event));
+}
+
+// handle_payload 统计流量并上报握手阶段的数据段，返回（可能新建的）流状态
+static __always_inline struct flow_state *handle_payload(struct __sk_buff *skb, struct flow_info *flow, struct session_key *key,
+                                                         struct flow_state *state, __u8 direction)
+{
+    __u8 first;
+    if (bpf_skb_load_bytes(skb, flow->payload_off, &first, 1) < 0)
+        return state;
+    
+    int socks5_start = direction == DIR_EGRESS && (first == 0x05 || first == 0x01);
+    if (!state) {
+        // 监控启动前建立的连接：只有客户端问候(0x05)或用户名密码认证(0x01)开始跟踪
+        if (!socks5_start)
+            return NULL;
+        struct flow_state init = {};
+        init.last_seen = bpf_ktime_get_ns();
+        bpf_map_update_elem(&socks5_flows, key, &init, BPF_NOEXIST);
+        state = bpf_map_lookup_elem(&socks5_flows, key);
+        if (!state)
+            return NULL;
+    }
+    
+    if (!(state->flags & FLOW_SOCKS5)) {
+        // 服务器先发言或客户端首个报文不是SOCKS5，不是需要关注的连接
+        if (!socks5_start) {
+            if (direction == DIR_EGRESS) {
+                bpf_map_delete_elem(&socks5_flows, key);
+                return NULL;
             }
+            return state;
+        }
+        state->flags |= FLOW_SOCKS5;
+    }
+    
+    // 流量计数，握手结束后用户空间扣除握手部分得到隧道流量
+    if (direction == DIR_EGRESS) {
+        __sync_fetch_and_add(&state->bytes_up, flow->payload_len);
+        __sync_fetch_and_add(&state->packets_up, 1);
+    } else {
+        __sync_fetch_and_add(&state->bytes_down, flow->payload_len);
+        __sync_fetch_and_add(&state->packets_down, 1);
+    }
+    
+    // 握手报文总长有限，超过上限后的数据转发不再上报
+    if (state->sent >= SOCKS5_HANDSHAKE_BYTES)
+        return state;
+    __sync_fetch_and_add(&state->sent, flow->payload_len);
+    
+    // 客户端用户名密码认证单独解析凭据，其余数据段原样上报
+    if (direction == DIR_EGRESS && first == 0x01)
+        emit_auth(skb, flow, direction);
+    else
+        emit_segment(skb, flow, direction);
+    return state;
+}
+
+// handle_packet 从L3头开始解析数据包并上报SOCKS5握手事件，TC与cgroup_skb共用
+static __always_inline void handle_packet(struct __sk_buff *skb, __u32 l3_off, __u16 proto, __u8 direction)
+{
+    // 解析IPv4/IPv6和TCP头，定位负载
+    struct flow_info flow = {};
+    if (parse_flow(skb, l3_off, proto, &flow) < 0)
+        return;
+    
+    // 检查是否为SOCKS5代理（出站看目的地址，入站看源地址）
+    if (direction == DIR_EGRESS) {
+        if (!is_socks5_proxy(flow.dst_addr, flow.dst_port))
+            return;
+    } else {
+        if (!is_socks5_proxy(flow.src_addr, flow.src_port))
+            return;
+    }
+    
+    // 只上报受监控进程树发起的连接；入站数据包没有关联socket，由用户空间按会话过滤
+    if (direction == DIR_EGRESS && !is_supervised_socket(skb))
+        return;
+    
+    // 以 客户端->代理 标识流，与数据包方向无关
+    struct session_key key = {};
+    if (direction == DIR_EGRESS) {
+        __builtin_memcpy(key.src_addr, flow.src_addr, 16);
+        key.src_port = flow.src_port;
+        key.dst_port = flow.dst_port;
+    } else {
+        __builtin_memcpy(key.src_addr, flow.dst_addr, 16);
+        key.src_port = flow.dst_port;
+        key.dst_port = flow.src_port;
+    }
+    
+    // 客户端发起连接：新建（或因端口复用重置）流状态并上报
+    if (direction == DIR_EGRESS && (flow.tcp_flags & (TCP_FLAG_SYN | TCP_FLAG_ACK)) == TCP_FLAG_SYN) {
+        struct flow_state init = {};
+        init.last_seen = bpf_ktime_get_ns();
+        bpf_map_update_elem(&socks5_flows, &key, &init, BPF_ANY);
+        emit_flow(skb, &flow, NULL, direction);
+        return;
+    }
+    
+    struct flow_state *state = bpf_map_lookup_elem(&socks5_flows, &key);
+    if (state)
+        state->last_seen = bpf_ktime_get_ns();
+    
+    // 代理应答SYN：只上报第一个，用户空间据此计算TCP建连耗时
+    if (direction == DIR_INGRESS && (flow.tcp_flags & (TCP_FLAG_SYN | TCP_FLAG_ACK)) == (TCP_FLAG_SYN | TCP_FLAG_ACK)) {
+        if (state && !(state->flags & FLOW_SYNACK)) {
+            state->flags |= FLOW_SYNACK;
+            emit_flow(skb, &flow, NULL, direction);
         }
+        return;
     }
     
+    if (flow.payload_len > 0)
+        state = handle_payload(skb, &flow, &key, state, direction);
+    
+    // 连接关闭：上报后在RST或双向FIN时删除流状态
+    if (!(flow.tcp_flags & (TCP_FLAG_FIN | TCP_FLAG_RST)) || !state)
+        return;
+    emit_flow(skb, &flow, state, direction);
+    if (flow.tcp_flags & TCP_FLAG_FIN)
+        state->flags |= direction == DIR_EGRESS ? FLOW_FIN_CLIENT : FLOW_FIN_PROXY;
+    if ((flow.tcp_flags & TCP_FLAG_RST) || (state->flags & (FLOW_FIN_CLIENT | FLOW_FIN_PROXY)) == (FLOW_FIN_CLIENT | FLOW_FIN_PROXY))
+        bpf_map_delete_elem(&socks5_flows, &key);
+}
+
+// handle_skb 解析以太网头后处理数据包（TC和socket filter中数据从L2开始）
+static __always_inline int handle_skb(struct __sk_buff *skb, __u8 direction)
+{
+    struct ethhdr eth;
+    if (bpf_skb_load_bytes(skb, 0, &eth, sizeof(eth)) < 0)
+        return TC_ACT_OK;
+    
+    handle_packet(skb, sizeof(eth), bpf_ntohs(eth.h_proto), direction);
     return TC_ACT_OK;
 }
 
+// record_socket_owner 在进程上下文中记录 socket cookie 对应的进程
+static __always_inline void record_socket_owner(struct sock *sk)
+{
+    __u64 cookie = bpf_get_socket_ptr_cookie(sk);
+    if (!cookie)
+        return;
+    
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    struct socket_owner *existing = bpf_map_lookup_elem(&socket_owners, &cookie);
+    if (existing && existing->tgid == (pid_tgid >> 32))
+        return;
+    
+    struct socket_owner owner = {};
+    owner.tgid = pid_tgid >> 32;
+    owner.pid = (__u32)pid_tgid;
+    bpf_get_current_comm(owner.comm, sizeof(owner.comm));
+    bpf_map_update_elem(&socket_owners, &cookie, &owner, BPF_ANY);
+}
+
+// 主动连接：connect() 系统调用上下文
+SEC("fentry/tcp_connect")
+int BPF_PROG(trace_tcp_connect, struct sock *sk)
+{
+    record_socket_owner(sk);
+    return 0;
+}
+
+// 发送数据：覆盖监控启动前已建立的连接，以及跨进程传递的socket
+SEC("fentry/tcp_sendmsg")
+int BPF_PROG(trace_tcp_sendmsg, struct sock *sk)
+{
+    record_socket_owner(sk);
+    return 0;
+}
+
+// 受监控进程fork时加入子进程（创建线程时加入的是TID，线程退出时删除）
+SEC("tracepoint/sched/sched_process_fork")
+int trace_process_fork(struct sched_process_fork_args *ctx)
+{
+    __u32 parent = bpf_get_current_pid_tgid() >> 32;
+    if (!bpf_map_lookup_elem(&supervised_tgids, &parent))
+        return 0;
+    
+    __u32 child = ctx->child_pid;
+    __u8 one = 1;
+    bpf_map_update_elem(&supervised_tgids, &child, &one, BPF_ANY);
+    return 0;
+}
+
+// 非主线程exec后TGID不变但线程号变化，按旧线程号继承
+SEC("tracepoint/sched/sched_process_exec")
+int trace_process_exec(struct sched_process_exec_args *ctx)
+{
+    __u32 old_pid = ctx->old_pid;
+    __u32 pid = ctx->pid;
+    if (old_pid == pid || !bpf_map_lookup_elem(&supervised_tgids, &old_pid))
+        return 0;
+    
+    __u8 one = 1;
+    bpf_map_update_elem(&supervised_tgids, &pid, &one, BPF_ANY);
+    return 0;
+}
+
+// 线程组主线程退出时按TGID移除进程
+// 其他线程退出时进程仍在运行，只删除fork时以该线程号加入的条目，保留进程的TGID
+SEC("tracepoint/sched/sched_process_exit")
+int trace_process_exit(void *ctx)
+{
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __u32 tgid = pid_tgid >> 32;
+    __u32 pid = (__u32)pid_tgid;
+
+    if (pid != tgid) {
+        bpf_map_delete_elem(&supervised_tgids, &pid);
+        return 0;
+    }
+    bpf_map_delete_elem(&supervised_tgids, &tgid);
+    return 0;
+}
+
+// 容器内网络流量监控 - TC (Traffic Control) egress 钩子
+SEC("tc")
+int container_traffic_monitor(struct __sk_buff *skb)
+{
+    return handle_skb(skb, DIR_EGRESS);
+}
+
+// 容器内网络流量监控 - TC (Traffic Control) ingress 钩子，捕获代理应答
+SEC("tc")
+int container_traffic_monitor_ingress(struct __sk_buff *skb)
+{
+    return handle_skb(skb, DIR_INGRESS);
+}
+
 // 容器内Socket监控 - Socket Filter
 SEC("socket")
 int container_socket_monitor(struct __sk_buff *skb)
 {
-    return container_traffic_monitor(skb);
+    return handle_skb(skb, DIR_EGRESS);
+}
+
+// cgroup v2 监控 - 挂载到 linuxService 所在cgroup，数据从L3开始，只观察不拦截
+SEC("cgroup_skb/egress")
+int cgroup_skb_egress(struct __sk_buff *skb)
+{
+    handle_packet(skb, 0, bpf_ntohs(skb->protocol), DIR_EGRESS);
+    return 1;
+}
+
+// cgroup v2 监控 - ingress，捕获代理应答
+SEC("cgroup_skb/ingress")
+int cgroup_skb_ingress(struct __sk_buff *skb)
+{
+    handle_packet(skb, 0, bpf_ntohs(skb->protocol), DIR_INGRESS);
+    return 1;
 }
 
 // 简化的容器内监控 - 移除复杂的XDP逻辑以提高兼容性